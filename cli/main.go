@@ -8,6 +8,7 @@ import (
 
 	"github.com/mh-cbon/print-template-tree/printer"
 	"github.com/mh-cbon/template-tree-simplifier/simplifier"
+	source "github.com/mh-cbon/template-tree-simplifier/simplifier/printer"
 )
 
 type tplData struct {
@@ -56,7 +57,11 @@ func main() {
 
 func printTemplateInfo(t *template.Template, data interface{}) {
 	fmt.Println("TEMPLATE CONTENT")
-	printer.PrintContent(t.Tree)
+	content, err := source.Print(t.Tree, source.Options{KeepTrim: true})
+	if err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(content)
 	fmt.Println("TEMPLATE EXECUTION")
 	printTemplateExec(t, data)
 	fmt.Println("TEMPLATE TREE")
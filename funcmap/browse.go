@@ -10,44 +10,154 @@ var tplFunc = map[string]interface{}{
 	"browsePropertyPath": BrowsePropertyPath,
 }
 
-//BrowsePropertyPath browse a property path ("b.c.d") on some value
+// BrowsePropertyPath browse a property path ("b.c.d") on some value,
+// the path is made of field names, map keys and method names,
+// the methods are called without arguments, but the last one which receives args.
+// It panics when the path can not be browsed, or a method fails,
+// text/template returns such a panic as the error of the execution.
 func BrowsePropertyPath(some interface{}, propertypath string, args ...interface{}) interface{} {
 	to := strings.Split(propertypath, ".")
-	var ret interface{}
 	v := reflect.ValueOf(some)
-	v = indirect(v)
 	for i := 0; i < len(to); i++ {
-		if v.IsValid() {
-			nv := v.FieldByName(to[i])
-			if !v.IsValid() && !v.IsNil() {
-				nv = v.MethodByName(to[i])
-				if !v.IsValid() {
-					err := fmt.Sprintf(
-						"Field/Method %q not found at %q in value of type %v",
-						strings.Join(to, "."),
-						strings.Join(to[:i], "."),
-						reflect.ValueOf(some),
-					)
-					panic(err)
-				}
-				// must be the last part
-				reflectArgs := []reflect.Value{}
-				for _, a := range args {
-					reflectArgs = append(reflectArgs, reflect.ValueOf(a))
+		v = indirect(v)
+		if !v.IsValid() {
+			err := fmt.Sprintf(
+				"Field/Method %q not found at %q in a nil value of %v",
+				strings.Join(to, "."),
+				strings.Join(to[:i], "."),
+				reflect.TypeOf(some),
+			)
+			panic(err)
+		}
+		var callArgs []interface{}
+		if i == len(to)-1 {
+			callArgs = args
+		}
+		if m := methodByName(v, to[i]); m.IsValid() {
+			v = call(m, callArgs)
+			continue
+		}
+		var nv reflect.Value
+		switch v.Kind() {
+		case reflect.Struct:
+			nv = v.FieldByName(to[i])
+		case reflect.Map:
+			key := reflect.ValueOf(to[i])
+			if key.Type().AssignableTo(v.Type().Key()) {
+				nv = v.MapIndex(key)
+				if !nv.IsValid() {
+					nv = reflect.Zero(v.Type().Elem())
 				}
-				return nv.Call(reflectArgs)
 			}
-			v = indirect(nv)
 		}
+		if !nv.IsValid() {
+			err := fmt.Sprintf(
+				"Field/Method %q not found at %q in value of type %v",
+				strings.Join(to, "."),
+				strings.Join(to[:i], "."),
+				reflect.TypeOf(some),
+			)
+			panic(err)
+		}
+		v = nv
 	}
-	return ret
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
 }
 
-func indirect(some reflect.Value) reflect.Value {
-	if some.Kind() == reflect.Ptr {
-		some = some.Elem()
+// methodByName returns the method name of v, or of its address.
+func methodByName(v reflect.Value, name string) reflect.Value {
+	if m := v.MethodByName(name); m.IsValid() {
+		return m
+	}
+	if v.CanAddr() {
+		return v.Addr().MethodByName(name)
+	}
+	return reflect.Value{}
+}
+
+// call calls the method m with args,
+// it panics with the error of a method returning a value and an error.
+// The arguments are given to the parameters of m as text/template would, see argValue.
+func call(m reflect.Value, args []interface{}) reflect.Value {
+	t := m.Type()
+	reflectArgs := []reflect.Value{}
+	for i, a := range args {
+		var in reflect.Type
+		if t.IsVariadic() && i >= t.NumIn()-1 {
+			in = t.In(t.NumIn() - 1).Elem()
+		} else if i < t.NumIn() {
+			in = t.In(i)
+		} else {
+			panic(fmt.Errorf("wrong number of args for method of type %v: want %v got %v", t, t.NumIn(), len(args)))
+		}
+		v, err := argValue(a, in)
+		if err != nil {
+			panic(fmt.Errorf("arg %v of method of type %v: %v", i, t, err))
+		}
+		reflectArgs = append(reflectArgs, v)
+	}
+	if len(reflectArgs) < t.NumIn() && !(t.IsVariadic() && len(reflectArgs) == t.NumIn()-1) {
+		panic(fmt.Errorf("wrong number of args for method of type %v: want %v got %v", t, t.NumIn(), len(args)))
+	}
+	out := m.Call(reflectArgs)
+	if len(out) == 0 {
+		panic(fmt.Sprintf("method of type %v returns no value", t))
+	}
+	if len(out) == 2 && !out[1].IsNil() {
+		panic(out[1].Interface())
 	}
-	if some.Kind() == reflect.Interface {
+	return out[0]
+}
+
+// argValue returns the argument a as a value of the parameter type typ, as text/template does,
+// nil is the zero value of the types which can be nil,
+// a pointer is dereferenced when its element is assignable to typ,
+// and an integer is converted to the numeric type typ,
+// such as the number literal of {{.Any.Half 3}}, given to a method of an interface value.
+func argValue(a interface{}, typ reflect.Type) (reflect.Value, error) {
+	v := reflect.ValueOf(a)
+	if !v.IsValid() {
+		switch typ.Kind() {
+		case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice:
+			return reflect.Zero(typ), nil
+		}
+		return reflect.Value{}, fmt.Errorf("cannot assign nil to %v", typ)
+	}
+	if v.Type().AssignableTo(typ) {
+		return v, nil
+	}
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Type().Elem().AssignableTo(typ) {
+		return v.Elem(), nil
+	}
+	if isInteger(v.Kind()) && (isInteger(typ.Kind()) || isFloat(typ.Kind())) {
+		return v.Convert(typ), nil
+	}
+	return reflect.Value{}, fmt.Errorf("wrong type for value; expected %v; got %v", typ, v.Type())
+}
+
+// isInteger tells if k is a signed or an unsigned integer kind.
+func isInteger(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// isFloat tells if k is a float kind.
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+func indirect(some reflect.Value) reflect.Value {
+	for some.Kind() == reflect.Ptr || some.Kind() == reflect.Interface {
+		if some.IsNil() {
+			return reflect.Value{}
+		}
 		some = some.Elem()
 	}
 	return some
@@ -0,0 +1,106 @@
+package funcmap_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mh-cbon/template-tree-simplifier/funcmap"
+)
+
+type user struct {
+	Name  string
+	Role  *role
+	Attrs map[string]interface{}
+	Any   interface{}
+}
+
+type role struct {
+	Title string
+}
+
+func (u user) Greet(greeting string, names ...string) string {
+	return greeting + " " + strings.Join(append([]string{u.Name}, names...), ", ")
+}
+func (u *user) Upper() string          { return strings.ToUpper(u.Name) }
+func (u user) Self() user              { return u }
+func (u user) Check() (string, error)  { return u.Name, nil }
+func (u user) Fail() (string, error)   { return "", errors.New("failed") }
+func (r role) Describe() (role, error) { return r, nil }
+func (r role) Half(f float64) float64  { return f / 2 }
+func (r role) Level(l int8) int8       { return l }
+
+func TestBrowsePropertyPath(t *testing.T) {
+	u := user{
+		Name:  "ann",
+		Role:  &role{Title: "admin"},
+		Attrs: map[string]interface{}{"db": map[string]string{"host": "h"}},
+		Any:   role{Title: "any"},
+	}
+	tests := []struct {
+		some   interface{}
+		path   string
+		args   []interface{}
+		expect interface{}
+	}{
+		{u, "Name", nil, "ann"},
+		{u, "Role.Title", nil, "admin"},
+		{u, "Any.Title", nil, "any"},
+		{u, "Attrs.db.host", nil, "h"},
+		{u, "Attrs.missing", nil, nil},
+		{u, "Self.Name", nil, "ann"},
+		{u, "Check", nil, "ann"},
+		{u, "Role.Describe.Title", nil, "admin"},
+		{u, "Greet", []interface{}{"hi"}, "hi ann"},
+		{u, "Self.Greet", []interface{}{"hi", "bob", "cid"}, "hi ann, bob, cid"},
+		{&u, "Upper", nil, "ANN"},
+		// the arguments are converted to the parameters, as text/template converts the number literals.
+		{u, "Any.Half", []interface{}{3}, 1.5},
+		{u, "Any.Level", []interface{}{uint(3)}, int8(3)},
+		{u, "Role.Half", []interface{}{2.5}, 1.25},
+		{map[string]interface{}{"u": &u}, "u.Upper", nil, "ANN"},
+	}
+	for i, test := range tests {
+		got := funcmap.BrowsePropertyPath(test.some, test.path, test.args...)
+		if got != test.expect {
+			t.Errorf("Test(%v): unexpected value at %q, expected=%v, got=%v", i, test.path, test.expect, got)
+		}
+	}
+}
+
+func TestBrowsePropertyPathPanics(t *testing.T) {
+	u := user{Name: "ann", Any: role{}}
+	tests := []struct {
+		some    interface{}
+		path    string
+		args    []interface{}
+		message string
+	}{
+		{u, "Nope", nil, `Field/Method "Nope" not found at "" in value of type funcmap_test.user`},
+		// the methods of *user are not found on a user value, as in text/template.
+		{u, "Upper", nil, `Field/Method "Upper" not found at "" in value of type funcmap_test.user`},
+		{u, "Role.Title", nil, `Field/Method "Role.Title" not found at "Role" in a nil value of funcmap_test.user`},
+		{u, "Fail", nil, "failed"},
+		{u, "Any.Half", []interface{}{"a"}, "arg 0 of method of type func(float64) float64: wrong type for value; expected float64; got string"},
+		{u, "Any.Level", []interface{}{1.5}, "arg 0 of method of type func(int8) int8: wrong type for value; expected int8; got float64"},
+		{u, "Any.Half", []interface{}{nil}, "arg 0 of method of type func(float64) float64: cannot assign nil to float64"},
+		{u, "Any.Half", nil, "wrong number of args for method of type func(float64) float64: want 1 got 0"},
+		{u, "Any.Half", []interface{}{1, 2}, "wrong number of args for method of type func(float64) float64: want 1 got 2"},
+	}
+	for i, test := range tests {
+		func() {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Errorf("Test(%v): expected a panic browsing %q", i, test.path)
+					return
+				}
+				if got := fmt.Sprint(r); got != test.message {
+					t.Errorf("Test(%v): unexpected panic\nexpected=%v\ngot     =%v", i, test.message, got)
+				}
+			}()
+			funcmap.BrowsePropertyPath(test.some, test.path, test.args...)
+		}()
+	}
+}
@@ -0,0 +1,297 @@
+package simplifier
+
+import (
+	"fmt"
+	"reflect"
+	text "text/template"
+)
+
+// builtin describes a function text/template provides to every template, ie: eq, len, printf.
+type builtin struct {
+	// signature is the type of the function, the arguments are checked against it.
+	signature reflect.Type
+	// result returns the type of the result for the types of the arguments,
+	// it checks the constraints the signature can not express.
+	// It is nil when the result is the one of the signature.
+	result func(args []reflect.Type) (reflect.Type, error)
+}
+
+// builtinSignature returns the type of the function pointed to by fn,
+// such as (*func(reflect.Value) bool)(nil).
+func builtinSignature(fn interface{}) reflect.Type {
+	return reflect.TypeOf(fn).Elem()
+}
+
+// builtins are the functions of text/template, by name.
+// Their signatures are the ones of text/template,
+// a reflect.Value parameter accepts any argument.
+var builtins = map[string]*builtin{
+	"and":      {signature: builtinSignature((*func(reflect.Value, ...reflect.Value) reflect.Value)(nil)), result: andOrType},
+	"or":       {signature: builtinSignature((*func(reflect.Value, ...reflect.Value) reflect.Value)(nil)), result: andOrType},
+	"not":      {signature: builtinSignature((*func(reflect.Value) bool)(nil))},
+	"call":     {signature: builtinSignature((*func(reflect.Value, ...reflect.Value) (reflect.Value, error))(nil)), result: callType},
+	"index":    {signature: builtinSignature((*func(reflect.Value, ...reflect.Value) (reflect.Value, error))(nil)), result: indexType},
+	"slice":    {signature: builtinSignature((*func(reflect.Value, ...reflect.Value) (reflect.Value, error))(nil)), result: sliceType},
+	"len":      {signature: builtinSignature((*func(reflect.Value) (int, error))(nil)), result: lenType},
+	"html":     {signature: reflect.TypeOf(text.HTMLEscaper)},
+	"js":       {signature: reflect.TypeOf(text.JSEscaper)},
+	"urlquery": {signature: reflect.TypeOf(text.URLQueryEscaper)},
+	"print":    {signature: reflect.TypeOf(fmt.Sprint)},
+	"printf":   {signature: reflect.TypeOf(fmt.Sprintf)},
+	"println":  {signature: reflect.TypeOf(fmt.Sprintln)},
+	"eq":       {signature: builtinSignature((*func(reflect.Value, ...reflect.Value) (bool, error))(nil)), result: eqType},
+	"ne":       {signature: builtinSignature((*func(reflect.Value, reflect.Value) (bool, error))(nil)), result: eqType},
+	"lt":       {signature: builtinSignature((*func(reflect.Value, reflect.Value) (bool, error))(nil)), result: ltType},
+	"le":       {signature: builtinSignature((*func(reflect.Value, reflect.Value) (bool, error))(nil)), result: ltType},
+	"gt":       {signature: builtinSignature((*func(reflect.Value, reflect.Value) (bool, error))(nil)), result: ltType},
+	"ge":       {signature: builtinSignature((*func(reflect.Value, reflect.Value) (bool, error))(nil)), result: ltType},
+}
+
+var (
+	boolType           = reflect.TypeOf(true)
+	intType            = reflect.TypeOf(0)
+	emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// isDynamic tells if the value of a type r is only known at runtime,
+// the arguments of such types are not checked.
+func isDynamic(r reflect.Type) bool {
+	return r == nil || r.Kind() == reflect.Interface
+}
+
+// andOrType types {{and}} and {{or}}, they return one of their arguments,
+// the result has the type of the arguments when they share it, an empty interface otherwise.
+func andOrType(args []reflect.Type) (reflect.Type, error) {
+	for _, arg := range args {
+		if arg == nil {
+			return nil, nil
+		}
+		if arg != args[0] {
+			return emptyInterfaceType, nil
+		}
+	}
+	return args[0], nil
+}
+
+// callType types {{call fn args...}}, it returns the result of fn,
+// the arguments and the results are checked against the signature of fn.
+func callType(args []reflect.Type) (reflect.Type, error) {
+	fn := args[0]
+	if isDynamic(fn) {
+		return nil, nil
+	}
+	if fn == NilType {
+		return nil, fmt.Errorf("call of nil")
+	}
+	if fn.Kind() != reflect.Func {
+		return nil, fmt.Errorf("non-function of type %v", fn)
+	}
+	if !isGoodFunc(fn) {
+		return nil, fmt.Errorf("function of type %v must return one value, or one value and an error", fn)
+	}
+	args = args[1:]
+	if fn.IsVariadic() && len(args) < fn.NumIn()-1 || !fn.IsVariadic() && len(args) != fn.NumIn() {
+		return nil, fmt.Errorf("wrong number of args: want %v got %v", fn.NumIn(), len(args))
+	}
+	for i, arg := range args {
+		if to := paramType(fn, i); !isAssignable(arg, to) {
+			return nil, fmt.Errorf("arg %v: value has type %v; should be %v", i, typeString(arg), to)
+		}
+	}
+	return fn.Out(0), nil
+}
+
+// indexType types {{index item indexes...}}, it returns the type of the indexed element.
+func indexType(args []reflect.Type) (reflect.Type, error) {
+	item := args[0]
+	if item == NilType {
+		return nil, fmt.Errorf("index of untyped nil")
+	}
+	for _, index := range args[1:] {
+		for item != nil && item.Kind() == reflect.Ptr {
+			item = item.Elem()
+		}
+		if isDynamic(item) {
+			return nil, nil
+		}
+		switch item.Kind() {
+		case reflect.Array, reflect.Slice, reflect.String:
+			if err := checkIndexArg(index); err != nil {
+				return nil, err
+			}
+			if item.Kind() == reflect.String {
+				item = reflect.TypeOf(byte(0))
+			} else {
+				item = item.Elem()
+			}
+		case reflect.Map:
+			if !isAssignable(index, item.Key()) {
+				return nil, fmt.Errorf("value has type %v; should be %v", typeString(index), item.Key())
+			}
+			item = item.Elem()
+		default:
+			return nil, fmt.Errorf("can't index item of type %v", item)
+		}
+	}
+	return item, nil
+}
+
+// sliceType types {{slice item indexes...}}, it returns the type of the slice.
+// text/template slices the arrays which are addressable only,
+// the caller gives those as slices of their elements.
+func sliceType(args []reflect.Type) (reflect.Type, error) {
+	item, indexes := args[0], args[1:]
+	if item == NilType {
+		return nil, fmt.Errorf("slice of untyped nil")
+	}
+	if len(indexes) > 3 {
+		return nil, fmt.Errorf("too many slice indexes: %d", len(indexes))
+	}
+	for _, index := range indexes {
+		if err := checkIndexArg(index); err != nil {
+			return nil, err
+		}
+	}
+	if isDynamic(item) {
+		return nil, nil
+	}
+	switch item.Kind() {
+	case reflect.String:
+		if len(indexes) == 3 {
+			return nil, fmt.Errorf("cannot 3-index slice a string")
+		}
+		return item, nil
+	case reflect.Slice:
+		return item, nil
+	case reflect.Array:
+		// the addressable arrays are given as slices of their elements.
+		return nil, fmt.Errorf("slice of unaddressable array")
+	}
+	return nil, fmt.Errorf("can't slice item of type %v", item)
+}
+
+// checkIndexArg checks the type of an index of an array, a slice or a string.
+func checkIndexArg(index reflect.Type) error {
+	if index == NilType {
+		return fmt.Errorf("cannot index slice/array with nil")
+	}
+	if isDynamic(index) {
+		return nil
+	}
+	switch index.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return nil
+	}
+	return fmt.Errorf("cannot index slice/array with type %v", index)
+}
+
+// lenType types {{len item}}.
+func lenType(args []reflect.Type) (reflect.Type, error) {
+	item := args[0]
+	for item != nil && item.Kind() == reflect.Ptr {
+		item = item.Elem()
+	}
+	if isDynamic(item) {
+		return intType, nil
+	}
+	switch item.Kind() {
+	case reflect.Array, reflect.Chan, reflect.Map, reflect.Slice, reflect.String:
+		return intType, nil
+	}
+	return intType, fmt.Errorf("len of type %v", item)
+}
+
+// comparisonKind is the kind of a type compared by eq, lt and the like,
+// the integers of any size are of the same kind.
+type comparisonKind int
+
+const (
+	invalidKind comparisonKind = iota
+	boolKind
+	complexKind
+	intKind
+	floatKind
+	stringKind
+	uintKind
+)
+
+// basicKind returns the comparison kind of a type, invalidKind when it is not basic.
+func basicKind(r reflect.Type) comparisonKind {
+	switch r.Kind() {
+	case reflect.Bool:
+		return boolKind
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return intKind
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return uintKind
+	case reflect.Float32, reflect.Float64:
+		return floatKind
+	case reflect.Complex64, reflect.Complex128:
+		return complexKind
+	case reflect.String:
+		return stringKind
+	}
+	return invalidKind
+}
+
+// isSignMix tells if k1 and k2 are a signed and an unsigned integer,
+// they can be compared regardless of their sign.
+func isSignMix(k1, k2 comparisonKind) bool {
+	return k1 == intKind && k2 == uintKind || k1 == uintKind && k2 == intKind
+}
+
+// eqType types {{eq arg1 arg2...}} and {{ne arg1 arg2}},
+// the first argument is compared to each of the others.
+// The values of a type which is not comparable, such as a slice, are only compared to nil.
+func eqType(args []reflect.Type) (reflect.Type, error) {
+	if len(args) < 2 {
+		return boolType, fmt.Errorf("missing argument for comparison")
+	}
+	arg1 := args[0]
+	if isDynamic(arg1) || arg1 == NilType {
+		return boolType, nil
+	}
+	k1 := basicKind(arg1)
+	for _, arg := range args[1:] {
+		if isDynamic(arg) || arg == NilType {
+			continue
+		}
+		k2 := basicKind(arg)
+		if k1 != k2 && !isSignMix(k1, k2) {
+			return boolType, fmt.Errorf("incompatible types for comparison")
+		}
+		if k1 == invalidKind && arg1.Kind() != arg.Kind() {
+			return boolType, fmt.Errorf("non-comparable types %v, %v", arg1, arg)
+		}
+		if k1 == invalidKind && !arg.Comparable() {
+			return boolType, fmt.Errorf("non-comparable type %v", arg)
+		}
+	}
+	return boolType, nil
+}
+
+// ltType types {{lt arg1 arg2}} and the other orderings,
+// they compare the integers, the floats and the strings.
+func ltType(args []reflect.Type) (reflect.Type, error) {
+	kinds := []comparisonKind{}
+	for _, arg := range args {
+		if isDynamic(arg) {
+			return boolType, nil
+		}
+		if arg == NilType {
+			return boolType, fmt.Errorf("invalid type for comparison")
+		}
+		kinds = append(kinds, basicKind(arg))
+	}
+	k1, k2 := kinds[0], kinds[1]
+	for _, k := range kinds {
+		if k == invalidKind || k == boolKind || k == complexKind {
+			return boolType, fmt.Errorf("invalid type for comparison")
+		}
+	}
+	if k1 != k2 && !isSignMix(k1, k2) {
+		return boolType, fmt.Errorf("incompatible types for comparison")
+	}
+	return boolType, nil
+}
@@ -0,0 +1,77 @@
+package simplifier_test
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/mh-cbon/template-tree-simplifier/simplifier"
+)
+
+// parseWithComments parses a template, keeping its comments.
+func parseWithComments(content string, funcs template.FuncMap) *template.Template {
+	tree := parse.New("")
+	tree.Mode = parse.ParseComments
+	treeSet := map[string]*parse.Tree{}
+	if _, err := tree.Parse(content, "", "", treeSet, funcs); err != nil {
+		panic(err)
+	}
+	tpl := template.New("").Funcs(funcs)
+	for name, t := range treeSet {
+		template.Must(tpl.AddParseTree(name, t))
+	}
+	return tpl
+}
+
+func TestComments(t *testing.T) {
+	//-
+	defFuncs := template.FuncMap{
+		"up":    strings.ToUpper,
+		"lower": strings.ToLower,
+	}
+
+	tplContent := `{{/* licence */}}{{$x := .Some}}{{/* before */}}{{up .Some | lower}}{{/* after */}}{{if .Some}}{{/* in if */}}{{$x := 1}}{{$x}}{{end}}`
+
+	t.Run("Simplify", func(t *testing.T) {
+		tpl := parseWithComments(tplContent, defFuncs)
+		simplifier.Simplify(tpl.Tree)
+		expected := `{{/* licence */}}{{$tplX := .Some}}{{/* before */}}{{$var0 := .Some}}{{$var2 := up $var0}}{{$var1 := lower $var2}}{{$var1}}{{/* after */}}{{$var3 := .Some}}{{if $var3}}{{/* in if */}}{{$tplX := 1}}{{$tplX}}{{end}}`
+		if got := tpl.Tree.Root.String(); got != expected {
+			t.Errorf("unexpected simplified template\nEXPECTED\n%v\nGOT\n%v", expected, got)
+		}
+	})
+
+	t.Run("Unshadow", func(t *testing.T) {
+		tpl := parseWithComments(tplContent, defFuncs)
+		simplifier.Unshadow(tpl.Tree)
+		expected := `{{/* licence */}}{{$x := .Some}}{{/* before */}}{{up .Some | lower}}{{/* after */}}{{if .Some}}{{/* in if */}}{{$xShadow := 1}}{{$xShadow}}{{end}}`
+		if got := tpl.Tree.Root.String(); got != expected {
+			t.Errorf("unexpected unshadowed template\nEXPECTED\n%v\nGOT\n%v", expected, got)
+		}
+	})
+
+	t.Run("TransformTree", func(t *testing.T) {
+		tpl := parseWithComments(tplContent, defFuncs)
+		simplifier.TransformTree(tpl.Tree, type2{}, defFuncs)
+		for _, comment := range []string{"licence", "before", "after", "in if"} {
+			if !strings.Contains(tpl.Tree.Root.String(), "{{/* "+comment+" */}}") {
+				t.Errorf("expected the comment %q to be preserved, got\n%v", comment, tpl.Tree.Root.String())
+			}
+		}
+	})
+
+	t.Run("IsUsingDot", func(t *testing.T) {
+		tpl := parseWithComments(`{{/* . */}}`, defFuncs)
+		if simplifier.IsUsingDot(tpl.Tree) {
+			t.Errorf("expected a comment not to use the dot")
+		}
+	})
+
+	t.Run("PrintsAnything", func(t *testing.T) {
+		tpl := parseWithComments(`{{/* comment */}}`, defFuncs)
+		if simplifier.PrintsAnything(tpl.Tree) {
+			t.Errorf("expected a comment not to print anything")
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package simplifier
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// Severity tells how bad a Diagnostic is.
+type Severity int
+
+const (
+	// SeverityError is a problem which prevents the template to be processed.
+	SeverityError Severity = iota
+	// SeverityWarning is a suspicious construct which does not prevent processing.
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic is a problem reported by a pass,
+// located within the template source.
+type Diagnostic struct {
+	Name     string    // the template name
+	Pos      parse.Pos // the byte offset of the faulty node within the template source
+	Line     int       // the line of the faulty node, starting at 1
+	Col      int       // the byte offset of the faulty node within its line, starting at 0
+	Severity Severity  // how bad the problem is
+	Message  string    // a short description of the problem
+	Err      error     // the underlying error
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%v:%v:%v: %v", d.Name, d.Line, d.Col, d.Message)
+}
+
+// Unwrap returns the underlying error.
+func (d *Diagnostic) Unwrap() error {
+	return d.Err
+}
+
+// messager is implemented by the errors of the package,
+// message describes the error without the func which failed.
+type messager interface {
+	message() string
+}
+
+// newDiagnostic creates a Diagnostic of err, located at node within tree.
+// If err is already a Diagnostic, it is returned as is.
+// The message of the Diagnostic does not tell the func which failed, err still does.
+func newDiagnostic(tree *parse.Tree, node parse.Node, severity Severity, err error) *Diagnostic {
+	if d, ok := err.(*Diagnostic); ok {
+		return d
+	}
+	d := &Diagnostic{
+		Severity: severity,
+		Message:  err.Error(),
+		Err:      err,
+	}
+	if m, ok := err.(messager); ok {
+		d.Message = m.message()
+	}
+	if tree != nil {
+		d.Name = tree.Name
+		if node != nil {
+			d.Pos = node.Position()
+			location, _ := tree.ErrorContext(node)
+			d.Line, d.Col = parseLocation(location)
+		}
+	}
+	return d
+}
+
+// parseLocation reads the line and column of a location
+// formatted by parse.Tree.ErrorContext, such as name:line:col.
+func parseLocation(location string) (int, int) {
+	parts := strings.Split(location, ":")
+	if len(parts) < 3 {
+		return 0, 0
+	}
+	line, _ := strconv.Atoi(parts[len(parts)-2])
+	col, _ := strconv.Atoi(parts[len(parts)-1])
+	return line, col
+}
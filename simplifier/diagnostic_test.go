@@ -0,0 +1,83 @@
+package simplifier_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/mh-cbon/template-tree-simplifier/simplifier"
+)
+
+type diagnosticTestData struct {
+	tplstr     string
+	data       interface{}
+	expectLine int
+	expectCol  int
+	expectErr  string
+}
+
+func TestDiagnostic(t *testing.T) {
+	//-
+	defFuncs := template.FuncMap{
+		"up": strings.ToUpper,
+	}
+
+	testTable := []diagnosticTestData{
+		diagnosticTestData{
+			tplstr:     `{{$x := .Nope}}`,
+			data:       type2{},
+			expectLine: 1,
+			expectCol:  8,
+			expectErr:  "path [Nope] not found in type simplifier_test.type2",
+		},
+		diagnosticTestData{
+			tplstr: `hello
+  {{.Some.Nope | up}}`,
+			data:       type3{},
+			expectLine: 2,
+			expectCol:  9,
+			expectErr:  "path [Some Nope] not found in type simplifier_test.type2",
+		},
+		diagnosticTestData{
+			tplstr: `{{with .Some}}
+{{end}}
+{{$x := .Some}}{{$y := $x.Nope}}`,
+			data:       type3{},
+			expectLine: 3,
+			expectCol:  25,
+			expectErr:  "path [Nope] not found in type simplifier_test.type2",
+		},
+	}
+
+	for i, testData := range testTable {
+		tpl, err := template.New("tpl").Funcs(defFuncs).Parse(testData.tplstr)
+		if err != nil {
+			t.Errorf("Test(%v): Failed to compiling original template: %v", i, err)
+			continue
+		}
+		_, err = simplifier.TransformTreeE(tpl.Tree, testData.data, defFuncs)
+		var diag *simplifier.Diagnostic
+		if !errors.As(err, &diag) {
+			t.Errorf("Test(%v): expected a *Diagnostic, got %T %v", i, err, err)
+			continue
+		}
+		if diag.Name != "tpl" {
+			t.Errorf("Test(%v): unexpected template name, expected=%q, got=%q", i, "tpl", diag.Name)
+		}
+		if diag.Severity != simplifier.SeverityError {
+			t.Errorf("Test(%v): unexpected severity, expected=%v, got=%v", i, simplifier.SeverityError, diag.Severity)
+		}
+		if diag.Line != testData.expectLine || diag.Col != testData.expectCol {
+			t.Errorf("Test(%v): unexpected location, expected=%v:%v, got=%v:%v",
+				i, testData.expectLine, testData.expectCol, diag.Line, diag.Col)
+		}
+		if diag.Message != testData.expectErr {
+			t.Errorf("Test(%v): unexpected message\nexpected=%v\ngot     =%v", i, testData.expectErr, diag.Message)
+		}
+		// the message is the one of the underlying error, without the func which failed.
+		if got := diag.Err.Error(); got == diag.Message || !strings.HasSuffix(got, ": "+diag.Message) {
+			t.Errorf("Test(%v): unexpected underlying error %v", i, got)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package simplifier
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"text/template/parse"
+)
+
+// UnhandledNodeError is raised when a pass meets a node
+// it does not know how to process.
+type UnhandledNodeError struct {
+	Op     string     // the func which failed, ie: treeSimplifier.browseNodes
+	Node   parse.Node // the unhandled node
+	Reason string     // why the node is not handled, defaults to "unhandled node type" and the type of Node
+}
+
+func (e *UnhandledNodeError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *UnhandledNodeError) message() string {
+	if e.Reason != "" {
+		return e.Reason
+	}
+	return fmt.Sprintf("unhandled node type %T", e.Node)
+}
+
+// NilCommandError is raised when nil is used as a command,
+// such as {{nil}}, text/template can not execute it.
+type NilCommandError struct {
+	Op   string     // the func which failed, ie: treeTypecheck.cmdType
+	Node parse.Node // the nil node
+}
+
+func (e *NilCommandError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *NilCommandError) message() string {
+	return "nil is not a command"
+}
+
+// PathNotFoundError is raised when a property path
+// can not be resolved against a type.
+type PathNotFoundError struct {
+	Op   string       // the func which failed, ie: State.BrowsePathType
+	Path []string     // the browsed path
+	Type reflect.Type // the type the path was not found in
+}
+
+func (e *PathNotFoundError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *PathNotFoundError) message() string {
+	return fmt.Sprintf("path %v not found in type %v", e.Path, typeString(e.Type))
+}
+
+// UnexportedFieldError is raised when a path
+// reads an unexported field of a struct, text/template can not read it.
+type UnexportedFieldError struct {
+	Op   string       // the func which failed, ie: State.BrowsePathType
+	Name string       // the field name
+	Type reflect.Type // the struct type
+}
+
+func (e *UnexportedFieldError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *UnexportedFieldError) message() string {
+	return fmt.Sprintf("%v is an unexported field of struct type %v", e.Name, e.Type)
+}
+
+// InsertFailedError is raised when a new node
+// could not be inserted around its reference node.
+type InsertFailedError struct {
+	Op   string     // the func which failed, ie: treeSimplifier.simplifyIfNode
+	Node parse.Node // the node to insert
+	Ref  parse.Node // the reference node which was not found
+}
+
+func (e *InsertFailedError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *InsertFailedError) message() string {
+	return fmt.Sprintf("failed to insert the new Action node, reference node %T not found", e.Ref)
+}
+
+// VariableNotFoundError is raised when a variable
+// is used before it was declared.
+type VariableNotFoundError struct {
+	Op   string     // the func which failed, ie: treeTypecheck.typeCheckActionNode
+	Name string     // the variable name
+	Node parse.Node // the node using the variable
+}
+
+func (e *VariableNotFoundError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *VariableNotFoundError) message() string {
+	return fmt.Sprintf("variable %v not found", e.Name)
+}
+
+// IncompatibleAssignError is raised when a variable
+// is assigned a value of a type it can not hold.
+type IncompatibleAssignError struct {
+	Op       string       // the func which failed, ie: treeTypecheck.addVar
+	Name     string       // the variable name
+	Type     reflect.Type // the type of the declared variable
+	Assigned reflect.Type // the type of the assigned value
+}
+
+func (e *IncompatibleAssignError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *IncompatibleAssignError) message() string {
+	return fmt.Sprintf("cannot assign a value of type %v to variable %v of type %v", typeString(e.Assigned), e.Name, e.Type)
+}
+
+// RangeTypeError is raised when a range
+// iterates over a value of a type it can not iterate over.
+type RangeTypeError struct {
+	Op     string       // the func which failed, ie: rangeTypes
+	Type   reflect.Type // the type of the ranged value
+	Reason string       // why the range is rejected
+}
+
+func (e *RangeTypeError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *RangeTypeError) message() string {
+	return fmt.Sprintf("%v %v", e.Reason, typeString(e.Type))
+}
+
+// TemplateDotTypeError is raised when a template
+// is called with a dot of a type it was not processed with.
+type TemplateDotTypeError struct {
+	Op     string       // the func which failed, ie: Transform
+	Name   string       // the called template
+	Type   reflect.Type // the type of the dot the template was processed with
+	Called reflect.Type // the type of the dot of the call
+}
+
+func (e *TemplateDotTypeError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *TemplateDotTypeError) message() string {
+	return fmt.Sprintf("template %q is called with a dot of type %v, it was processed with a dot of type %v", e.Name, typeString(e.Called), e.Type)
+}
+
+// UncalledTemplateError is reported when a template
+// is never called from the template executed.
+type UncalledTemplateError struct {
+	Op   string // the func which reported it, ie: TypeCheckTemplates
+	Name string // the uncalled template
+	Root string // the template executed
+}
+
+func (e *UncalledTemplateError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *UncalledTemplateError) message() string {
+	return fmt.Sprintf("template %q is never called from template %q", e.Name, e.Root)
+}
+
+// FuncArgCountError is raised when a function
+// is called with a wrong number of arguments.
+type FuncArgCountError struct {
+	Op       string // the func which failed, ie: treeTypecheck.checkCall
+	Name     string // the called function
+	Want     int    // the number of parameters of the function
+	Got      int    // the number of arguments, including the piped value
+	Variadic bool   // the function is variadic, it wants at least Want-1 arguments
+}
+
+func (e *FuncArgCountError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *FuncArgCountError) message() string {
+	if e.Variadic {
+		return fmt.Sprintf("wrong number of args for %v: want at least %v got %v", e.Name, e.Want-1, e.Got)
+	}
+	return fmt.Sprintf("wrong number of args for %v: want %v got %v", e.Name, e.Want, e.Got)
+}
+
+// FuncArgTypeError is raised when a function
+// is called with an argument of a type its parameter can not hold.
+type FuncArgTypeError struct {
+	Op       string       // the func which failed, ie: treeTypecheck.checkCall
+	Name     string       // the called function
+	Arg      int          // the position of the argument, starting at 1, the piped value is the last one
+	Type     reflect.Type // the type of the argument
+	Expected reflect.Type // the type of the parameter
+}
+
+func (e *FuncArgTypeError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *FuncArgTypeError) message() string {
+	return fmt.Sprintf("wrong type for arg %v of %v: expected %v, got %v", e.Arg, e.Name, e.Expected, typeString(e.Type))
+}
+
+// FuncResultError is raised when a function is called,
+// but it does not return one value, or one value and an error, text/template can not call it.
+type FuncResultError struct {
+	Op   string       // the func which failed, ie: treeTypecheck.checkCall
+	Name string       // the called function
+	Type reflect.Type // the type of the function
+}
+
+func (e *FuncResultError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *FuncResultError) message() string {
+	return fmt.Sprintf("function %v of type %v must return one value, or one value and an error", e.Name, e.Type)
+}
+
+// NotAFunctionError is raised when arguments are given
+// to a value which is not a function, or a method, such as a field.
+type NotAFunctionError struct {
+	Op   string // the func which failed, ie: treeTypecheck.notAFunction
+	Name string // the value given arguments
+}
+
+func (e *NotAFunctionError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *NotAFunctionError) message() string {
+	return fmt.Sprintf("can't give argument to non-function %v", e.Name)
+}
+
+// BuiltinCallError is raised when a builtin function, ie: index, len, eq,
+// is called with arguments text/template rejects.
+type BuiltinCallError struct {
+	Op     string // the func which failed, ie: treeTypecheck.funcCallType
+	Name   string // the called builtin
+	Reason string // why the call is rejected
+}
+
+func (e *BuiltinCallError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *BuiltinCallError) message() string {
+	return fmt.Sprintf("error calling %v: %v", e.Name, e.Reason)
+}
+
+// NumberOverflowError is raised when a number literal is typed as an int,
+// but does not fit an int, such as {{print 18446744073709551615}}.
+type NumberOverflowError struct {
+	Op   string // the func which failed, ie: numberType
+	Text string // the literal
+}
+
+func (e *NumberOverflowError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *NumberOverflowError) message() string {
+	return fmt.Sprintf("%v overflows int", e.Text)
+}
+
+// StubActionError is raised when the stub ActionNode,
+// the new actions of a tree without any ActionNode are copied from, can not be parsed.
+type StubActionError struct {
+	Op         string // the func which failed, ie: stubActionNode
+	LeftDelim  string // the left delimiter of the tree
+	RightDelim string // the right delimiter of the tree
+	Err        error  // the parse error
+}
+
+func (e *StubActionError) Error() string {
+	return e.Op + ": " + e.message()
+}
+
+func (e *StubActionError) message() string {
+	return fmt.Sprintf("failed to parse an action with the delimiters %q and %q: %v", e.LeftDelim, e.RightDelim, e.Err)
+}
+
+// Unwrap returns the parse error.
+func (e *StubActionError) Unwrap() error {
+	return e.Err
+}
+
+// recoverError is the handler that turns panics into returns
+// from the top level of the error returning funcs.
+// Runtime errors are not recovered, they are bugs.
+func recoverError(errp *error) {
+	e := recover()
+	if e != nil {
+		if _, ok := e.(runtime.Error); ok {
+			panic(e)
+		}
+		if err, ok := e.(error); ok {
+			*errp = err
+			return
+		}
+		panic(e)
+	}
+}
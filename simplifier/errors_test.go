@@ -0,0 +1,73 @@
+package simplifier_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/mh-cbon/template-tree-simplifier/simplifier"
+)
+
+func TestErrors(t *testing.T) {
+	//-
+	defFuncs := template.FuncMap{
+		"up": strings.ToUpper,
+	}
+
+	t.Run("TransformE reports unhandled template types", func(t *testing.T) {
+		_, err := simplifier.TransformE("not a template", nil, defFuncs)
+		if err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+
+	t.Run("TypeCheckE reports unknown paths", func(t *testing.T) {
+		tpl := template.Must(template.New("").Funcs(defFuncs).Parse(`{{$x := .Nope}}`))
+		_, err := simplifier.TypeCheckE(tpl.Tree, type2{}, defFuncs)
+		var pathErr *simplifier.PathNotFoundError
+		if !errors.As(err, &pathErr) {
+			t.Fatalf("expected a *PathNotFoundError, got %T %v", err, err)
+		}
+		if strings.Join(pathErr.Path, ".") != "Nope" {
+			t.Errorf("unexpected path, expected=%v, got=%v", "Nope", pathErr.Path)
+		}
+	})
+
+	t.Run("TransformTreeE reports unknown paths", func(t *testing.T) {
+		tpl := template.Must(template.New("").Funcs(defFuncs).Parse(`{{.Some.Nope | up}}`))
+		_, err := simplifier.TransformTreeE(tpl.Tree, type3{}, defFuncs)
+		var pathErr *simplifier.PathNotFoundError
+		if !errors.As(err, &pathErr) {
+			t.Fatalf("expected a *PathNotFoundError, got %T %v", err, err)
+		}
+	})
+
+	t.Run("valid templates do not error", func(t *testing.T) {
+		tpl := template.Must(template.New("").Funcs(defFuncs).Parse(`{{.Some | up}}`))
+		if _, err := simplifier.TransformTreeE(tpl.Tree, type2{}, defFuncs); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	})
+
+	t.Run("TypeCheckE reports incompatible assignments", func(t *testing.T) {
+		tpl := template.Must(template.New("").Funcs(defFuncs).Parse(`{{$x := "a"}}{{$x = 1}}`))
+		_, err := simplifier.TypeCheckE(tpl.Tree, type2{}, defFuncs)
+		var assignErr *simplifier.IncompatibleAssignError
+		if !errors.As(err, &assignErr) {
+			t.Fatalf("expected a *IncompatibleAssignError, got %T %v", err, err)
+		}
+		if assignErr.Name != "$x" {
+			t.Errorf("unexpected variable, expected=%v, got=%v", "$x", assignErr.Name)
+		}
+	})
+
+	t.Run("TypeCheckE reports nil commands", func(t *testing.T) {
+		tpl := template.Must(template.New("").Funcs(defFuncs).Parse(`{{nil}}`))
+		_, err := simplifier.TypeCheckE(tpl.Tree, type2{}, defFuncs)
+		var nilErr *simplifier.NilCommandError
+		if !errors.As(err, &nilErr) {
+			t.Fatalf("expected a *NilCommandError, got %T %v", err, err)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package simplifier_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/mh-cbon/template-tree-simplifier/simplifier"
+)
+
+func TestPositions(t *testing.T) {
+	//-
+	defFuncs := template.FuncMap{
+		"up": strings.ToUpper,
+		"fail": func(s string) (string, error) {
+			return "", errors.New("failed")
+		},
+	}
+
+	tpls := []string{
+		"hello\n\n  {{up (fail .Some)}}",
+		"hello\n\n  {{.Some | fail | up}}",
+		"hello\n\n  {{if eq (fail .Some) \"x\"}}{{end}}",
+		"hello\n\n  {{with $x := .Some}}{{fail $x | up}}{{end}}",
+	}
+
+	for i, tplContent := range tpls {
+		tpl := template.Must(template.New("").Funcs(defFuncs).Parse(tplContent))
+		simplifier.Simplify(tpl.Tree)
+
+		checkPositions(t, i, tplContent, tpl.Tree.Root)
+
+		_, err := exectemplate(tpl, type2{Some: "some"})
+		if err == nil {
+			t.Errorf("Test(%v): expected an execution error, got nil", i)
+			continue
+		}
+		if !strings.Contains(err.Error(), ":3:") {
+			t.Errorf("Test(%v): expected the execution error to be located at line 3\nTEMPLATE:%v\nSIMPLIFIED:%v\nERROR:%v",
+				i, tplContent, tpl.Tree.Root.String(), err)
+		}
+	}
+}
+
+// checkPositions verifies that every action node of list,
+// and its pipe, commands and arguments, are located after the leading text.
+func checkPositions(t *testing.T, i int, tplContent string, list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *parse.ActionNode:
+			checkPipePositions(t, i, tplContent, node, node.Pipe)
+		case *parse.IfNode:
+			checkPipePositions(t, i, tplContent, node, node.Pipe)
+			checkPositions(t, i, tplContent, node.List)
+			checkPositions(t, i, tplContent, node.ElseList)
+		case *parse.WithNode:
+			checkPipePositions(t, i, tplContent, node, node.Pipe)
+			checkPositions(t, i, tplContent, node.List)
+			checkPositions(t, i, tplContent, node.ElseList)
+		}
+	}
+}
+
+func checkPipePositions(t *testing.T, i int, tplContent string, owner parse.Node, pipe *parse.PipeNode) {
+	nodes := []parse.Node{owner, pipe}
+	for _, decl := range pipe.Decl {
+		nodes = append(nodes, decl)
+	}
+	for _, cmd := range pipe.Cmds {
+		nodes = append(nodes, cmd)
+		nodes = append(nodes, cmd.Args...)
+	}
+	for _, n := range nodes {
+		if n.Position() < parse.Pos(len("hello\n\n")) {
+			t.Errorf("Test(%v): node %q of type %T is located at %v\nTEMPLATE:%v",
+				i, n.String(), n, n.Position(), tplContent)
+		}
+	}
+}
+
+func TestSimplifyWithoutAction(t *testing.T) {
+	//-
+	defFuncs := map[string]interface{}{
+		"up": strings.ToUpper,
+	}
+	builtins := map[string]interface{}{
+		"eq": func(a, b interface{}) bool { return a == b },
+	}
+	tests := []struct {
+		tplstr string
+		left   string
+		right  string
+		expect string
+	}{
+		{`{{if eq 1 2}}{{end}}`, "", "", `{{$var0 := eq 1 2}}{{if $var0}}{{end}}`},
+		{`{{/* c */}}{{range up "a"}}{{end}}`, "", "", `{{/* c */}}{{$var0 := up "a"}}{{range $var0}}{{end}}`},
+		{`<<with up "a">><<end>>`, "<<", ">>", `{{$var0 := up "a"}}{{with $var0}}{{end}}`},
+		{`<<template "t" up "a">>`, "<<", ">>", `{{$var0 := up "a"}}{{template "t" $var0}}`},
+		// the delimiters are the ones of the tree, whatever the keywords they contain.
+		{`if(with up "a")endif(end)end`, "if(", ")end", `{{$var0 := up "a"}}{{with $var0}}{{end}}`},
+		{`end(template "t" up "a")if`, "end(", ")if", `{{$var0 := up "a"}}{{template "t" $var0}}`},
+	}
+	for i, test := range tests {
+		tree := parse.New("")
+		tree.Mode = parse.ParseComments
+		if _, err := tree.Parse(test.tplstr, test.left, test.right, map[string]*parse.Tree{}, defFuncs, builtins); err != nil {
+			t.Fatalf("Test(%v): failed to parse the template: %v", i, err)
+		}
+		simplifier.Simplify(tree)
+		got := tree.Root.String()
+		// the nodes are printed with the delimiters of the tree, depending on the version of Go.
+		if test.left != "" {
+			got = strings.NewReplacer(test.left, "{{", test.right, "}}").Replace(got)
+		}
+		if got != test.expect {
+			t.Errorf("Test(%v): unexpected simplified template\nexpected=%v\ngot     =%v", i, test.expect, got)
+		}
+	}
+}
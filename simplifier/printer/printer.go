@@ -0,0 +1,407 @@
+// Package printer writes template trees back to their source form.
+//
+// Unlike parse.Tree.Root.String(),
+// it restores the trim markers and the whitespaces they trim,
+// prints the comments, the {{else if}} and {{else with}} chains,
+// the {{define}} and the {{block}} of a template set,
+// and it can write the templates with other delimiters.
+// The printed source parses back to an equal tree.
+package printer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// Options of the printer.
+type Options struct {
+	// LeftDelim and RightDelim are the delimiters of the printed templates,
+	// they default to {{ and }}.
+	LeftDelim  string
+	RightDelim string
+	// SourceLeftDelim and SourceRightDelim are the delimiters the templates were parsed with,
+	// they default to {{ and }}, they are needed to read the trim markers and the blocks of the source.
+	SourceLeftDelim  string
+	SourceRightDelim string
+	// KeepTrim restores the trim markers, {{- and -}},
+	// and the whitespaces they trim, from the source of the templates.
+	KeepTrim bool
+}
+
+// TextDelimError is returned when a text contains the left delimiter
+// of the printed templates, it would not be read back as a text.
+type TextDelimError struct {
+	Text  string // the text
+	Delim string // the left delimiter
+}
+
+func (e *TextDelimError) Error() string {
+	return fmt.Sprintf("printer: the text %q contains the left delimiter %q", e.Text, e.Delim)
+}
+
+// Print returns the source of a tree.
+// A {{template}} is printed as is, see PrintSet to print the blocks.
+func Print(tree *parse.Tree, opts Options) (string, error) {
+	p := newPrinter(nil, opts)
+	if err := p.printTree(tree); err != nil {
+		return "", err
+	}
+	return p.b.String(), nil
+}
+
+// PrintSet returns the source of a set of templates, such as the one of template.Template.Templates.
+// The template name is printed first, followed by a {{define}} of every other template,
+// in the order of their names,
+// the templates declared with a {{block}} are printed in place.
+func PrintSet(trees map[string]*parse.Tree, name string, opts Options) (string, error) {
+	files, err := PrintFiles(trees, name, opts)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString(files[name])
+	for _, n := range sortedNames(files) {
+		if n != name {
+			b.WriteString(files[n])
+		}
+	}
+	return b.String(), nil
+}
+
+// PrintFiles returns the source of each template of a set, by name,
+// the template name is printed as is, the others within a {{define}}.
+// The templates declared with a {{block}} are printed in place, they have no file of their own.
+func PrintFiles(trees map[string]*parse.Tree, name string, opts Options) (map[string]string, error) {
+	p := newPrinter(trees, opts)
+	files := map[string]string{}
+	for _, n := range sortedNames(trees) {
+		if p.blocks[n] {
+			continue
+		}
+		p.b.Reset()
+		p.spaces = map[int]bool{}
+		var err error
+		if n == name {
+			err = p.printTree(trees[n])
+		} else {
+			err = p.printDefine(n, trees[n])
+		}
+		if err != nil {
+			return nil, err
+		}
+		files[n] = p.b.String()
+	}
+	return files, nil
+}
+
+// sortedNames returns the keys of m in order.
+func sortedNames[T any](m map[string]T) []string {
+	names := []string{}
+	for n := range m {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// printer holds,
+// the set of templates, to print the blocks,
+// the names of the templates declared with a {{block}},
+// the sources of the templates, by text,
+// the source of the tree being printed, nil when it is not available,
+// the offsets of the spaces already printed.
+type printer struct {
+	opts    Options
+	b       strings.Builder
+	trees   map[string]*parse.Tree
+	blocks  map[string]bool
+	sources map[string]*source
+	src     *source
+	spaces  map[int]bool
+}
+
+func newPrinter(trees map[string]*parse.Tree, opts Options) *printer {
+	if opts.LeftDelim == "" {
+		opts.LeftDelim = "{{"
+	}
+	if opts.RightDelim == "" {
+		opts.RightDelim = "}}"
+	}
+	if opts.SourceLeftDelim == "" {
+		opts.SourceLeftDelim = "{{"
+	}
+	if opts.SourceRightDelim == "" {
+		opts.SourceRightDelim = "}}"
+	}
+	p := &printer{
+		opts:    opts,
+		trees:   trees,
+		blocks:  map[string]bool{},
+		sources: map[string]*source{},
+		spaces:  map[int]bool{},
+	}
+	for _, tree := range trees {
+		p.source(tree)
+		collectBlocks(tree.Root, func(node *parse.TemplateNode) {
+			if p.isBlock(node) {
+				p.blocks[node.Name] = true
+			}
+		})
+	}
+	p.src = nil
+	return p
+}
+
+// source sets the source of the tree being printed.
+func (p *printer) source(tree *parse.Tree) {
+	p.src = nil
+	text := treeText(tree)
+	if text == "" {
+		return
+	}
+	if _, ok := p.sources[text]; !ok {
+		p.sources[text] = newSource(text, p.opts.SourceLeftDelim, p.opts.SourceRightDelim)
+	}
+	p.src = p.sources[text]
+}
+
+// isBlock tells if node was declared with a {{block}} of a template of the set.
+// Without the source of the template, a block is printed as a {{template}} and a {{define}}.
+func (p *printer) isBlock(node *parse.TemplateNode) bool {
+	a := p.actionOf(node)
+	return a != nil && a.keyword == "block" && p.trees[node.Name] != nil
+}
+
+// actionOf returns the action of the source which contains node, or nil.
+func (p *printer) actionOf(node parse.Node) *action {
+	if p.src == nil || node == nil {
+		return nil
+	}
+	if _, ok := node.(*parse.TextNode); ok {
+		return nil
+	}
+	return p.src.actionAt(node.Position())
+}
+
+func (p *printer) printTree(tree *parse.Tree) error {
+	p.source(tree)
+	return p.printList(tree.Root)
+}
+
+// printDefine prints a template within a {{define}}.
+func (p *printer) printDefine(name string, tree *parse.Tree) error {
+	p.source(tree)
+	var a *action
+	if p.src != nil {
+		a = p.src.define(name)
+	}
+	p.open(a, true)
+	p.b.WriteString(fmt.Sprintf("define %q", name))
+	p.close(a, true)
+	if err := p.printList(tree.Root); err != nil {
+		return err
+	}
+	p.printEnd(a)
+	return nil
+}
+
+// open prints the left delimiter of the action a,
+// with its trim marker when trim is true.
+func (p *printer) open(a *action, trim bool) {
+	if p.opts.KeepTrim && a != nil && a.leftTrim && trim {
+		p.space(p.src.spaceBefore(a))
+		p.b.WriteString(p.opts.LeftDelim + "- ")
+		return
+	}
+	p.b.WriteString(p.opts.LeftDelim)
+}
+
+// close prints the right delimiter of the action a,
+// with its trim marker when trim is true.
+func (p *printer) close(a *action, trim bool) {
+	if p.opts.KeepTrim && a != nil && a.rightTrim && trim {
+		p.b.WriteString(" -" + p.opts.RightDelim)
+		p.space(p.src.spaceAfter(a))
+		return
+	}
+	p.b.WriteString(p.opts.RightDelim)
+}
+
+// space prints the spaces of the source from start to end,
+// unless they were already printed.
+func (p *printer) space(start, end int) {
+	if p.spaces[start] || start == end {
+		return
+	}
+	p.spaces[start] = true
+	p.b.WriteString(p.src.text[start:end])
+}
+
+// printEnd prints the {{end}} of a control structure opened by a.
+func (p *printer) printEnd(a *action) {
+	var end *action
+	if p.src != nil {
+		end = p.src.endOf(a)
+	}
+	p.open(end, true)
+	p.b.WriteString("end")
+	p.close(end, true)
+}
+
+// printList prints the nodes of a list.
+// The nodes created by a transformation are located at the node they originate from,
+// consecutive nodes of the same action share its trim markers,
+// the left one is printed on the first node, the right one on the last node.
+func (p *printer) printList(list *parse.ListNode) error {
+	if list == nil {
+		return nil
+	}
+	for i, node := range list.Nodes {
+		a := p.actionOf(node)
+		leftTrim := i == 0 || p.actionOf(list.Nodes[i-1]) != a
+		rightTrim := i == len(list.Nodes)-1 || p.actionOf(list.Nodes[i+1]) != a
+		if err := p.printNode(node, leftTrim, rightTrim); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *printer) printNode(node parse.Node, leftTrim, rightTrim bool) error {
+	a := p.actionOf(node)
+	switch node := node.(type) {
+
+	case *parse.TextNode:
+		if strings.Contains(string(node.Text), p.opts.LeftDelim) {
+			return &TextDelimError{Text: string(node.Text), Delim: p.opts.LeftDelim}
+		}
+		p.b.Write(node.Text)
+
+	case *parse.ActionNode:
+		p.open(a, leftTrim)
+		p.b.WriteString(node.Pipe.String())
+		p.close(a, rightTrim)
+
+	case *parse.CommentNode:
+		p.open(a, leftTrim)
+		p.b.WriteString(node.Text)
+		p.close(a, rightTrim)
+
+	case *parse.BreakNode:
+		p.open(a, leftTrim)
+		p.b.WriteString("break")
+		p.close(a, rightTrim)
+
+	case *parse.ContinueNode:
+		p.open(a, leftTrim)
+		p.b.WriteString("continue")
+		p.close(a, rightTrim)
+
+	case *parse.TemplateNode:
+		keyword := "template"
+		if p.isBlock(node) {
+			keyword = "block"
+		}
+		p.open(a, leftTrim)
+		p.b.WriteString(fmt.Sprintf("%v %q", keyword, node.Name))
+		if node.Pipe != nil {
+			p.b.WriteString(" " + node.Pipe.String())
+		}
+		p.close(a, rightTrim)
+		if keyword == "block" {
+			if err := p.printList(p.trees[node.Name].Root); err != nil {
+				return err
+			}
+			p.printEnd(a)
+		}
+
+	case *parse.IfNode:
+		return p.printBranch("if", &node.BranchNode, a, leftTrim, rightTrim, false)
+
+	case *parse.RangeNode:
+		return p.printBranch("range", &node.BranchNode, a, leftTrim, rightTrim, false)
+
+	case *parse.WithNode:
+		return p.printBranch("with", &node.BranchNode, a, leftTrim, rightTrim, false)
+
+	default:
+		return fmt.Errorf("printer: unhandled node type %T", node)
+	}
+	return nil
+}
+
+// printBranch prints a control structure,
+// an else list made of a single control structure of the same keyword
+// is printed as an {{else if}} or an {{else with}}, then chained is true.
+func (p *printer) printBranch(keyword string, node *parse.BranchNode, a *action, leftTrim, rightTrim, chained bool) error {
+	p.open(a, leftTrim)
+	if chained {
+		p.b.WriteString("else ")
+	}
+	p.b.WriteString(keyword + " " + node.Pipe.String())
+	p.close(a, rightTrim)
+	if err := p.printList(node.List); err != nil {
+		return err
+	}
+	if node.ElseList != nil {
+		var elseAction *action
+		if p.src != nil {
+			elseAction = p.src.elseOf(a)
+		}
+		if branch := elseBranch(keyword, node.ElseList); branch != nil {
+			b := p.actionOf(node.ElseList.Nodes[0])
+			return p.printBranch(keyword, branch, b, true, true, true)
+		}
+		p.open(elseAction, true)
+		p.b.WriteString("else")
+		p.close(elseAction, true)
+		if err := p.printList(node.ElseList); err != nil {
+			return err
+		}
+	}
+	p.printEnd(a)
+	return nil
+}
+
+// elseBranch returns the control structure of an else list
+// made of a single control structure of the given keyword, or nil.
+func elseBranch(keyword string, list *parse.ListNode) *parse.BranchNode {
+	if len(list.Nodes) != 1 {
+		return nil
+	}
+	switch node := list.Nodes[0].(type) {
+	case *parse.IfNode:
+		if keyword == "if" {
+			return &node.BranchNode
+		}
+	case *parse.WithNode:
+		if keyword == "with" {
+			return &node.BranchNode
+		}
+	}
+	return nil
+}
+
+// collectBlocks calls fn for each TemplateNode of the list.
+func collectBlocks(list *parse.ListNode, fn func(*parse.TemplateNode)) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *parse.TemplateNode:
+			fn(node)
+		case *parse.IfNode:
+			collectBlocks(node.List, fn)
+			collectBlocks(node.ElseList, fn)
+		case *parse.RangeNode:
+			collectBlocks(node.List, fn)
+			collectBlocks(node.ElseList, fn)
+		case *parse.WithNode:
+			collectBlocks(node.List, fn)
+			collectBlocks(node.ElseList, fn)
+		}
+	}
+}
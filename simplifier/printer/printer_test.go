@@ -0,0 +1,172 @@
+package printer_test
+
+import (
+	"errors"
+	"testing"
+	"text/template/parse"
+
+	"github.com/mh-cbon/template-tree-simplifier/simplifier"
+	"github.com/mh-cbon/template-tree-simplifier/simplifier/printer"
+)
+
+// parseSet parses a template source, keeping its comments.
+func parseSet(t *testing.T, text, leftDelim, rightDelim string) map[string]*parse.Tree {
+	tree := parse.New("")
+	tree.Mode = parse.ParseComments | parse.SkipFuncCheck
+	treeSet := map[string]*parse.Tree{}
+	if _, err := tree.Parse(text, leftDelim, rightDelim, treeSet); err != nil {
+		t.Fatalf("failed to parse %q: %v", text, err)
+	}
+	return treeSet
+}
+
+// checkEqualSets checks that the printed set parses back to the same trees,
+// the expected trees were parsed with the delimiters leftDelim and rightDelim, the others with the default ones.
+// As a tree may be printed with its own delimiters, both are printed with the default ones to be compared.
+func checkEqualSets(t *testing.T, expected map[string]*parse.Tree, leftDelim, rightDelim string, got map[string]*parse.Tree) {
+	if len(expected) != len(got) {
+		t.Errorf("unexpected number of templates, expected=%v, got=%v", len(expected), len(got))
+	}
+	for name, tree := range expected {
+		if got[name] == nil {
+			t.Errorf("template %q is missing", name)
+			continue
+		}
+		e := printTree(t, tree, printer.Options{SourceLeftDelim: leftDelim, SourceRightDelim: rightDelim})
+		g := printTree(t, got[name], printer.Options{})
+		if e != g {
+			t.Errorf("template %q differs\nEXPECTED\n%v\nGOT\n%v", name, e, g)
+		}
+	}
+}
+
+// printTree prints a tree with the default delimiters.
+func printTree(t *testing.T, tree *parse.Tree, opts printer.Options) string {
+	s, err := printer.Print(tree, opts)
+	if err != nil {
+		t.Fatalf("failed to print %v: %v", tree.Name, err)
+	}
+	return s
+}
+
+func TestPrintSet(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+		keepTrim bool
+	}{
+		{
+			text:     "a {{- .X -}} b\n{{range .Y -}}\n  {{.}}\n{{- end}}",
+			expected: "a {{- .X -}} b\n{{range .Y -}}\n  {{.}}\n{{- end}}",
+			keepTrim: true,
+		},
+		{
+			text:     "a {{- .X -}} b\n{{range .Y -}}\n  {{.}}\n{{- end}}",
+			expected: "a{{.X}}b\n{{range .Y}}{{.}}{{end}}",
+		},
+		{
+			text:     "{{/* c */}}x\n{{- /* d */ -}}\n y",
+			expected: "{{/* c */}}x\n{{- /* d */ -}}\n y",
+			keepTrim: true,
+		},
+		{
+			text:     "{{if .A -}} a {{- else if .B}}b{{else}}c{{end}}",
+			expected: "{{if .A -}} a {{- else if .B}}b{{else}}c{{end}}",
+			keepTrim: true,
+		},
+		{
+			text:     "{{if .A}}a{{else}}{{if .B}}b{{end}}{{end}}",
+			expected: "{{if .A}}a{{else if .B}}b{{end}}",
+		},
+		{
+			text:     "{{with .A}}a{{else with .B}}b{{end}}{{range .C}}c{{else}}{{if .D}}d{{end}}{{end}}",
+			expected: "{{with .A}}a{{else with .B}}b{{end}}{{range .C}}c{{else}}{{if .D}}d{{end}}{{end}}",
+		},
+		{
+			text:     `{{define "x" -}} X{{.}} {{- end}}root{{block "b" .}}B{{end}}{{template "x" .}}`,
+			expected: `root{{block "b" .}}B{{end}}{{template "x" .}}{{define "x" -}} X{{.}} {{- end}}`,
+			keepTrim: true,
+		},
+		{
+			text:     `{{define "x"}}X{{end}}{{block "b" .}}B{{end}}`,
+			expected: `{{block "b" .}}B{{end}}{{define "x"}}X{{end}}`,
+		},
+		{
+			text:     `{{range .}}{{if .}}{{break}}{{end}}{{continue}}{{end}}`,
+			expected: `{{range .}}{{if .}}{{break}}{{end}}{{continue}}{{end}}`,
+		},
+		{
+			text:     "{{`}}` -}} a {{- \"{{\" -}} b",
+			expected: "{{`}}` -}} a {{- \"{{\" -}} b",
+			keepTrim: true,
+		},
+	}
+	for i, test := range tests {
+		trees := parseSet(t, test.text, "", "")
+		got, err := printer.PrintSet(trees, "", printer.Options{KeepTrim: test.keepTrim})
+		if err != nil {
+			t.Errorf("Test(%v): unexpected error %v", i, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("Test(%v): unexpected source\nEXPECTED\n%q\nGOT\n%q", i, test.expected, got)
+		}
+		checkEqualSets(t, trees, "", "", parseSet(t, got, "", ""))
+	}
+}
+
+func TestPrintDelims(t *testing.T) {
+	text := "a <<- .X>> b [[ c"
+	trees := parseSet(t, text, "<<", ">>")
+
+	got, err := printer.PrintSet(trees, "", printer.Options{SourceLeftDelim: "<<", SourceRightDelim: ">>", KeepTrim: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "a {{- .X}} b [[ c"; got != expected {
+		t.Errorf("unexpected source\nEXPECTED\n%q\nGOT\n%q", expected, got)
+	}
+	checkEqualSets(t, trees, "<<", ">>", parseSet(t, got, "", ""))
+
+	_, err = printer.PrintSet(trees, "", printer.Options{LeftDelim: "[[", RightDelim: "]]"})
+	var delimErr *printer.TextDelimError
+	if !errors.As(err, &delimErr) {
+		t.Errorf("expected a *TextDelimError, got %T %v", err, err)
+	}
+}
+
+func TestPrintFiles(t *testing.T) {
+	trees := parseSet(t, `{{define "x"}}X{{end}}{{define "y"}}Y{{block "b" .}}B{{end}}{{end}}root`, "", "")
+	files, err := printer.PrintFiles(trees, "", printer.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"":  `root`,
+		"x": `{{define "x"}}X{{end}}`,
+		"y": `{{define "y"}}Y{{block "b" .}}B{{end}}{{end}}`,
+	}
+	if len(files) != len(expected) {
+		t.Errorf("unexpected files %v", files)
+	}
+	for name, content := range expected {
+		if files[name] != content {
+			t.Errorf("unexpected file %q, expected=%q, got=%q", name, content, files[name])
+		}
+	}
+}
+
+func TestPrintSimplified(t *testing.T) {
+	text := "a {{- up .S -}} b\n{{if eq (up .S) \"A\" -}}\n  yes\n{{- end}}"
+	trees := parseSet(t, text, "", "")
+	simplifier.Simplify(trees[""])
+	got, err := printer.Print(trees[""], printer.Options{KeepTrim: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "a {{- $var0 := .S}}{{$var1 := up $var0}}{{$var1 -}} b\n{{$var4 := .S}}{{$var3 := up $var4}}{{$var2 := eq $var3 \"A\"}}{{if $var2 -}}\n  yes\n{{- end}}"
+	if got != expected {
+		t.Errorf("unexpected source\nEXPECTED\n%q\nGOT\n%q", expected, got)
+	}
+	checkEqualSets(t, trees, "", "", parseSet(t, got, "", ""))
+}
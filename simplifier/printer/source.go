@@ -0,0 +1,240 @@
+package printer
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"unicode"
+)
+
+// action is an action of a template source, {{...}}.
+type action struct {
+	start     int    // the offset of the left delimiter
+	end       int    // the offset after the right delimiter
+	leftTrim  bool   // the action starts with a trim marker, {{-
+	rightTrim bool   // the action ends with a trim marker, -}}
+	keyword   string // the keyword of the action, ie: if, else, end, define, it is empty for the other actions
+	name      string // the template name of a define, block or template action
+}
+
+// source is the text a tree was parsed from, and its actions.
+type source struct {
+	text    string
+	actions []*action
+}
+
+// treeText returns the text a tree was parsed from.
+// text/template keeps it unexported, it is read by reflection,
+// it returns an empty string when it is not available.
+func treeText(tree *parse.Tree) string {
+	v := reflect.ValueOf(tree).Elem().FieldByName("text")
+	if v.Kind() != reflect.String {
+		return ""
+	}
+	return v.String()
+}
+
+// newSource scans the actions of text, delimited by leftDelim and rightDelim.
+func newSource(text, leftDelim, rightDelim string) *source {
+	s := &source{text: text}
+	i := 0
+	for {
+		x := strings.Index(text[i:], leftDelim)
+		if x < 0 {
+			break
+		}
+		a := &action{start: i + x}
+		i = a.start + len(leftDelim)
+		if len(text) >= i+2 && text[i] == '-' && isSpace(text[i+1]) {
+			a.leftTrim = true
+			i += 2
+		}
+		i = skipSpaces(text, i)
+		if strings.HasPrefix(text[i:], "/*") {
+			// a comment
+			y := strings.Index(text[i:], "*/")
+			if y < 0 {
+				break
+			}
+			i += y + len("*/")
+		} else {
+			a.keyword, a.name = actionKeyword(text[i:])
+		}
+		i = scanAction(text, i, rightDelim, a)
+		s.actions = append(s.actions, a)
+	}
+	return s
+}
+
+// scanAction scans the inside of the action a, starting at i, until its right delimiter.
+// It returns the offset after the right delimiter.
+func scanAction(text string, i int, rightDelim string, a *action) int {
+	for i < len(text) {
+		if len(text) >= i+2 && isSpace(text[i]) && text[i+1] == '-' && strings.HasPrefix(text[i+2:], rightDelim) {
+			a.rightTrim = true
+			a.end = i + 2 + len(rightDelim)
+			return a.end
+		}
+		if strings.HasPrefix(text[i:], rightDelim) {
+			a.end = i + len(rightDelim)
+			return a.end
+		}
+		switch text[i] {
+		case '"', '\'':
+			i = skipQuoted(text, i)
+		case '`':
+			if y := strings.IndexByte(text[i+1:], '`'); y > -1 {
+				i += y + 2
+			} else {
+				i = len(text)
+			}
+		default:
+			i++
+		}
+	}
+	a.end = len(text)
+	return a.end
+}
+
+// actionKeyword returns the keyword at the start of the inside of an action,
+// and the template name which follows the define, block and template keywords.
+func actionKeyword(inside string) (string, string) {
+	x := strings.IndexFunc(inside, func(r rune) bool { return !unicode.IsLetter(r) })
+	if x < 0 {
+		x = len(inside)
+	}
+	keyword := inside[:x]
+	switch keyword {
+	case "if", "range", "with", "else", "end", "break", "continue":
+		return keyword, ""
+	case "define", "block", "template":
+		rest := inside[skipSpaces(inside, x):]
+		var literal string
+		if strings.HasPrefix(rest, "`") {
+			if y := strings.IndexByte(rest[1:], '`'); y > -1 {
+				literal = rest[:y+2]
+			}
+		} else if strings.HasPrefix(rest, `"`) {
+			literal = rest[:skipQuoted(rest, 0)]
+		}
+		name, _ := strconv.Unquote(literal)
+		return keyword, name
+	}
+	return "", ""
+}
+
+// skipQuoted returns the offset after the quoted string, or char, starting at i.
+func skipQuoted(text string, i int) int {
+	quote := text[i]
+	for i++; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(text)
+}
+
+// skipSpaces returns the offset of the first non space character of text from i.
+func skipSpaces(text string, i int) int {
+	for i < len(text) && isSpace(text[i]) {
+		i++
+	}
+	return i
+}
+
+// isSpace tells if c is a space, as understood by the trim markers.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// actionAt returns the action containing the offset pos, or nil.
+func (s *source) actionAt(pos parse.Pos) *action {
+	p := int(pos)
+	for i := len(s.actions) - 1; i >= 0; i-- {
+		a := s.actions[i]
+		if a.start <= p {
+			if p < a.end {
+				return a
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// index returns the index of a within the actions, or -1.
+func (s *source) index(a *action) int {
+	for i, b := range s.actions {
+		if a == b {
+			return i
+		}
+	}
+	return -1
+}
+
+// elseOf returns the else action of the control structure opened by a, or nil.
+func (s *source) elseOf(a *action) *action {
+	e, _ := s.branchEnds(a)
+	return e
+}
+
+// endOf returns the end action of the control structure opened by a, or nil.
+func (s *source) endOf(a *action) *action {
+	_, e := s.branchEnds(a)
+	return e
+}
+
+// branchEnds returns the first else action and the end action
+// of the control structure opened by a.
+// For an {{else if}} action, they are the next else action of the chain and its end.
+func (s *source) branchEnds(a *action) (*action, *action) {
+	if a == nil {
+		return nil, nil
+	}
+	var elseAction *action
+	depth := 0
+	for _, b := range s.actions[s.index(a)+1:] {
+		switch b.keyword {
+		case "if", "range", "with", "block", "define":
+			depth++
+		case "else":
+			if depth == 0 && elseAction == nil {
+				elseAction = b
+			}
+		case "end":
+			if depth == 0 {
+				return elseAction, b
+			}
+			depth--
+		}
+	}
+	return elseAction, nil
+}
+
+// define returns the define action of the template name, or nil.
+func (s *source) define(name string) *action {
+	for _, a := range s.actions {
+		if a.keyword == "define" && a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// spaceBefore returns the offsets of the spaces before a.
+func (s *source) spaceBefore(a *action) (int, int) {
+	i := a.start
+	for i > 0 && isSpace(s.text[i-1]) {
+		i--
+	}
+	return i, a.start
+}
+
+// spaceAfter returns the offsets of the spaces after a.
+func (s *source) spaceAfter(a *action) (int, int) {
+	return a.end, skipSpaces(s.text, a.end)
+}
@@ -1,7 +1,6 @@
 package simplifier
 
 import (
-	"fmt"
 	"text/template/parse"
 )
 
@@ -51,6 +50,11 @@ func browseNodesToCheckIfItPrintsAnything(l interface{}) bool {
 			}
 		}
 
+	case *parse.ChainNode:
+		if browseNodesToCheckIfItPrintsAnything(node.Node) {
+			return true
+		}
+
 	case *parse.RangeNode:
 		if browseNodesToCheckIfItPrintsAnything(node.Pipe) {
 			return true
@@ -99,6 +103,12 @@ func browseNodesToCheckIfItPrintsAnything(l interface{}) bool {
 		// pass
 	case *parse.BoolNode:
 		// pass
+	case *parse.NilNode:
+		// pass
+	case *parse.BreakNode:
+		// pass
+	case *parse.ContinueNode:
+		// pass
 	case *parse.IdentifierNode:
 		// pass
 	case *parse.DotNode:
@@ -107,9 +117,12 @@ func browseNodesToCheckIfItPrintsAnything(l interface{}) bool {
 		// pass
 	case *parse.TextNode:
 		return true
+	case *parse.CommentNode:
+		// pass
 
 	default:
-		err := fmt.Errorf("browseNodesToCheckIfItPrintsAnything: unhandled node type\n%v\n%#v", node, node)
+		n, _ := node.(parse.Node)
+		err := &UnhandledNodeError{Op: "browseNodesToCheckIfItPrintsAnything", Node: n}
 		panic(err)
 	}
 	return false
@@ -53,6 +53,13 @@ func TestPrintsAnything(t *testing.T) {
 			printsanything: true,
 			expectPrints:   true,
 		},
+		TestData{
+			tplstr:         `{{if eq . nil}}{{end}}`,
+			funcs:          defFuncs,
+			data:           []string{},
+			printsanything: true,
+			expectPrints:   false,
+		},
 	}
 
 	for i, testData := range testTable {
@@ -1,7 +1,6 @@
 package simplifier
 
 import (
-	"fmt"
 	"text/template/parse"
 
 	"github.com/serenize/snaker"
@@ -41,6 +40,9 @@ func renameVariables(l interface{}) {
 			renameVariables(child)
 		}
 
+	case *parse.ChainNode:
+		renameVariables(node.Node)
+
 	case *parse.RangeNode:
 		renameVariables(node.Pipe)
 		renameVariables(node.List)
@@ -67,6 +69,12 @@ func renameVariables(l interface{}) {
 		// pass
 	case *parse.BoolNode:
 		// pass
+	case *parse.NilNode:
+		// pass
+	case *parse.BreakNode:
+		// pass
+	case *parse.ContinueNode:
+		// pass
 	case *parse.IdentifierNode:
 		// pass
 	case *parse.DotNode:
@@ -75,9 +83,12 @@ func renameVariables(l interface{}) {
 		// pass
 	case *parse.TextNode:
 		// pass
+	case *parse.CommentNode:
+		// pass
 
 	default:
-		err := fmt.Errorf("renameVariables: unhandled node type\n%v\n%#v", node, node)
+		n, _ := node.(parse.Node)
+		err := &UnhandledNodeError{Op: "renameVariables", Node: n}
 		panic(err)
 	}
 }
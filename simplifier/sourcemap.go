@@ -0,0 +1,211 @@
+package simplifier
+
+import (
+	"strings"
+	"text/template/parse"
+)
+
+// Origin locates an expression within the original template source.
+type Origin struct {
+	Node parse.Node // the original node, note that the transformation may have modified it in place
+	Pos  parse.Pos  // the byte offset of the expression within the original template source
+	Line int        // the line of the expression, starting at 1
+	Col  int        // the byte offset of the expression within its line, starting at 0
+	Text string     // the original expression, ie: up "what" | lower
+}
+
+// SourceMap maps the nodes of a simplified tree,
+// and the variables it declares,
+// back to the original template source.
+type SourceMap struct {
+	// origins of the original nodes per position, outermost first.
+	origins map[parse.Pos][]Origin
+	nodes   map[parse.Node]Origin
+	vars    map[string]Origin
+}
+
+// newSourceMap records the origins of the nodes of the tree,
+// it must be called before the tree is transformed.
+func newSourceMap(tree *parse.Tree) *SourceMap {
+	m := &SourceMap{
+		origins: map[parse.Pos][]Origin{},
+		nodes:   map[parse.Node]Origin{},
+		vars:    map[string]Origin{},
+	}
+	walkSourceNodes(tree.Root, func(node parse.Node) {
+		o := Origin{
+			Node: node,
+			Pos:  node.Position(),
+			Text: sourceText(node),
+		}
+		location, _ := tree.ErrorContext(node)
+		o.Line, o.Col = parseLocation(location)
+		m.origins[o.Pos] = append(m.origins[o.Pos], o)
+	})
+	return m
+}
+
+// index maps the nodes of the transformed tree to their origins,
+// decls are the nodes each variable created by the simplifier was made of.
+// The simplifier positions the nodes it creates at their originating node,
+// a node is mapped to the original node of the same type at its position,
+// or, for the new nodes, to the outermost original node at its position.
+func (m *SourceMap) index(tree *parse.Tree, decls map[string][]parse.Node) {
+	for name, nodes := range decls {
+		m.vars[name] = m.declOrigin(nodes)
+	}
+	walkSourceNodes(tree.Root, func(node parse.Node) {
+		origins := m.origins[node.Position()]
+		if len(origins) == 0 {
+			return
+		}
+		m.nodes[node] = matchOrigin(node, origins)
+		if pipe, ok := node.(*parse.PipeNode); ok {
+			for _, decl := range pipe.Decl {
+				origins := m.origins[decl.Position()]
+				if _, ok := m.vars[decl.Ident[0]]; !ok && len(origins) > 0 {
+					m.vars[decl.Ident[0]] = matchOrigin(decl, origins)
+				}
+			}
+		}
+	})
+}
+
+// matchOrigin returns the origin of node among the origins at its position,
+// the node itself, or the first node of the same type, or the outermost node.
+func matchOrigin(node parse.Node, origins []Origin) Origin {
+	for _, origin := range origins {
+		if origin.Node == node {
+			return origin
+		}
+	}
+	for _, origin := range origins {
+		if origin.Node.Type() == node.Type() {
+			return origin
+		}
+	}
+	return origins[0]
+}
+
+// declOrigin returns the origin of a variable created by the simplifier,
+// it is the expression made of the original nodes, ie: up "what" | lower
+func (m *SourceMap) declOrigin(nodes []parse.Node) Origin {
+	texts := []string{}
+	var o Origin
+	for i, node := range nodes {
+		origin := Origin{Node: node, Pos: node.Position(), Text: node.String()}
+		if origins := m.origins[node.Position()]; len(origins) > 0 {
+			origin = matchOrigin(node, origins)
+		}
+		if i == 0 {
+			o = origin
+		}
+		texts = append(texts, origin.Text)
+	}
+	o.Text = strings.Join(texts, " | ")
+	return o
+}
+
+// Node returns the origin of a node of the simplified tree.
+func (m *SourceMap) Node(node parse.Node) (Origin, bool) {
+	o, ok := m.nodes[node]
+	return o, ok
+}
+
+// Var returns the origin of a variable declared in the simplified tree,
+// for a variable created by the simplifier, such as $var0,
+// it is the expression the variable holds.
+func (m *SourceMap) Var(name string) (Origin, bool) {
+	o, ok := m.vars[name]
+	return o, ok
+}
+
+// sourceText returns the expression text of a node,
+// for nodes owning a pipe, it is the text of the pipe.
+func sourceText(node parse.Node) string {
+	switch node := node.(type) {
+	case *parse.ActionNode:
+		return node.Pipe.String()
+	case *parse.IfNode:
+		return node.Pipe.String()
+	case *parse.RangeNode:
+		return node.Pipe.String()
+	case *parse.WithNode:
+		return node.Pipe.String()
+	case *parse.TemplateNode:
+		if node.Pipe != nil {
+			return node.Pipe.String()
+		}
+		return ""
+	}
+	return node.String()
+}
+
+// walkSourceNodes browses the nodes of l, outermost first,
+// it calls fn for each of them except the lists.
+func walkSourceNodes(l parse.Node, fn func(parse.Node)) {
+	switch node := l.(type) {
+
+	case *parse.ListNode:
+		if node != nil {
+			for _, child := range node.Nodes {
+				walkSourceNodes(child, fn)
+			}
+		}
+
+	case *parse.ActionNode:
+		fn(node)
+		walkSourceNodes(node.Pipe, fn)
+
+	case *parse.PipeNode:
+		if node != nil {
+			fn(node)
+			for _, child := range node.Decl {
+				walkSourceNodes(child, fn)
+			}
+			for _, child := range node.Cmds {
+				walkSourceNodes(child, fn)
+			}
+		}
+
+	case *parse.CommandNode:
+		fn(node)
+		for _, child := range node.Args {
+			walkSourceNodes(child, fn)
+		}
+
+	case *parse.ChainNode:
+		fn(node)
+		walkSourceNodes(node.Node, fn)
+
+	case *parse.RangeNode:
+		fn(node)
+		walkSourceNodes(node.Pipe, fn)
+		walkSourceNodes(node.List, fn)
+		walkSourceNodes(node.ElseList, fn)
+
+	case *parse.IfNode:
+		fn(node)
+		walkSourceNodes(node.Pipe, fn)
+		walkSourceNodes(node.List, fn)
+		walkSourceNodes(node.ElseList, fn)
+
+	case *parse.WithNode:
+		fn(node)
+		walkSourceNodes(node.Pipe, fn)
+		walkSourceNodes(node.List, fn)
+		walkSourceNodes(node.ElseList, fn)
+
+	case *parse.TemplateNode:
+		fn(node)
+		if node.Pipe != nil {
+			walkSourceNodes(node.Pipe, fn)
+		}
+
+	default:
+		// leaves, they are located but not browsed.
+		if node != nil {
+			fn(node)
+		}
+	}
+}
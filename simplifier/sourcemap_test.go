@@ -0,0 +1,68 @@
+package simplifier_test
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/mh-cbon/template-tree-simplifier/simplifier"
+)
+
+func TestSourceMap(t *testing.T) {
+	//-
+	defFuncs := template.FuncMap{
+		"split": strings.Split,
+		"up":    strings.ToUpper,
+		"lower": strings.ToLower,
+	}
+
+	tplContent := "hello\n  {{\"some\" | split ((\"what\" | lower) | up)}}{{$x := .Some}}{{if .Some}}{{end}}"
+	tpl := template.Must(template.New("").Funcs(defFuncs).Parse(tplContent))
+	state := simplifier.TransformTree(tpl.Tree, type2{}, defFuncs)
+	sourceMap := state.SourceMap()
+	if sourceMap == nil {
+		t.Fatalf("expected a source map, got nil")
+	}
+
+	vars := []struct {
+		name string
+		text string
+		line int
+		col  int
+	}{
+		{name: "$var0", text: `("what" | lower) | up`, line: 2, col: 20},
+		{name: "$var1", text: `("what" | lower)`, line: 2, col: 20},
+		{name: "$var2", text: `"some" | split (("what" | lower) | up)`, line: 2, col: 4},
+		{name: "$tplX", text: `$x`, line: 2, col: 46},
+		{name: "$var3", text: `.Some`, line: 2, col: 64},
+	}
+	for _, v := range vars {
+		o, ok := sourceMap.Var(v.name)
+		if !ok {
+			t.Errorf("expected variable %v to be mapped\nSIMPLIFIED:%v", v.name, tpl.Tree.Root.String())
+			continue
+		}
+		if o.Text != v.text {
+			t.Errorf("unexpected text for %v, expected=%q, got=%q", v.name, v.text, o.Text)
+		}
+		if o.Line != v.line || o.Col != v.col {
+			t.Errorf("unexpected location for %v, expected=%v:%v, got=%v:%v", v.name, v.line, v.col, o.Line, o.Col)
+		}
+	}
+
+	// every action of the simplified tree is mapped to the original line.
+	for _, node := range tpl.Tree.Root.Nodes {
+		if _, ok := node.(*parse.TextNode); ok {
+			continue
+		}
+		o, ok := sourceMap.Node(node)
+		if !ok {
+			t.Errorf("expected node %v to be mapped", node)
+			continue
+		}
+		if o.Line != 2 {
+			t.Errorf("unexpected line for node %v, expected=2, got=%v", node, o.Line)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package simplifier
+
+import (
+	"fmt"
+	html "html/template"
+	"reflect"
+	"sort"
+	text "text/template"
+	"text/template/parse"
+)
+
+// TypeCheckTemplates type checks a set of templates, such as the one of template.Template.Templates.
+// The template name is checked with data as its dot,
+// the templates it calls, {{template "name" pipeline}}, are checked with the type of the pipeline,
+// a template called with different types is checked once per distinct type.
+// It returns the States of each template, one per distinct dot type in their order of discovery,
+// and a warning for each template which is never called from the template name.
+// The templates never called are checked with an unknown dot type.
+// When the template name has no tree, such as the root of a set made by ParseFiles,
+// every template is checked with data as its dot, and no warning is returned.
+func TypeCheckTemplates(trees map[string]*parse.Tree, name string, data interface{}, funcs map[string]interface{}) (map[string][]*State, []*Diagnostic) {
+	states := map[string][]*State{}
+	warnings := walkTemplates(trees, name, reflect.TypeOf(data), true, func(name string, dot reflect.Type) *State {
+		s, _ := typeCheckDot(trees[name], dot, funcs, false)
+		states[name] = append(states[name], s)
+		return s
+	})
+	return states, warnings
+}
+
+// TypeCheckTemplatesE is like TypeCheckTemplates,
+// but it returns an error rather than panicking.
+func TypeCheckTemplatesE(trees map[string]*parse.Tree, name string, data interface{}, funcs map[string]interface{}) (states map[string][]*State, warnings []*Diagnostic, err error) {
+	defer recoverError(&err)
+	states, warnings = TypeCheckTemplates(trees, name, data, funcs)
+	return states, warnings, nil
+}
+
+// templateTrees returns the trees of the templates associated with some,
+// a *text.Template or a *html.Template, by name.
+// It panics if the value type is unexpected.
+func templateTrees(op string, some interface{}) map[string]*parse.Tree {
+	trees := map[string]*parse.Tree{}
+	if t, ok := some.(*text.Template); ok {
+		for _, tpl := range t.Templates() {
+			if tpl.Tree != nil {
+				trees[tpl.Name()] = tpl.Tree
+			}
+		}
+
+	} else if h, ok := some.(*html.Template); ok {
+		for _, tpl := range h.Templates() {
+			if tpl.Tree != nil {
+				trees[tpl.Name()] = tpl.Tree
+			}
+		}
+	} else {
+		err := fmt.Errorf("%v: unhandled template type %T", op, some)
+		panic(err)
+	}
+	return trees
+}
+
+// templateVisit is a pending visit of a template with a dot type.
+type templateVisit struct {
+	name string
+	dot  reflect.Type
+}
+
+// walkTemplates browses the templates of a set, starting at the template name with the dot type dot,
+// following the calls of the States returned by visit.
+// visit is called once per template and distinct dot type,
+// unless perType is false, then a template called with a second type is rejected.
+// The templates which are not reached are then visited with an unknown dot type, their calls are not followed,
+// it returns a warning for each of them.
+// When the template name has no tree, such as the root of a set made by ParseFiles,
+// every template is visited with the dot type dot, in the order of their names,
+// their calls are not followed, and no warning is returned.
+func walkTemplates(trees map[string]*parse.Tree, name string, dot reflect.Type, perType bool, visit func(name string, dot reflect.Type) *State) []*Diagnostic {
+	if trees[name] == nil {
+		for _, n := range sortedNames(trees) {
+			visit(n, dot)
+		}
+		return []*Diagnostic{}
+	}
+	visited := map[string][]reflect.Type{name: {dot}}
+	queue := []templateVisit{{name: name, dot: dot}}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		tree := trees[v.name]
+		state := visit(v.name, v.dot)
+		for _, call := range state.Calls() {
+			if trees[call.Name] == nil {
+				// text/template reports it at execution.
+				continue
+			}
+			dots, ok := visited[call.Name]
+			if containsType(dots, call.Dot) {
+				continue
+			}
+			if ok && !perType {
+				err := &TemplateDotTypeError{Op: "walkTemplates", Name: call.Name, Type: dots[0], Called: call.Dot}
+				panic(newDiagnostic(tree, call.Node, SeverityError, err))
+			}
+			visited[call.Name] = append(dots, call.Dot)
+			queue = append(queue, templateVisit{name: call.Name, dot: call.Dot})
+		}
+	}
+
+	warnings := []*Diagnostic{}
+	for _, n := range sortedNames(trees) {
+		if _, ok := visited[n]; ok {
+			continue
+		}
+		tree := trees[n]
+		err := &UncalledTemplateError{Op: "walkTemplates", Name: n, Root: name}
+		warnings = append(warnings, newDiagnostic(tree, tree.Root, SeverityWarning, err))
+		visit(n, nil)
+	}
+	return warnings
+}
+
+// sortedNames returns the names of trees, sorted.
+func sortedNames(trees map[string]*parse.Tree) []string {
+	names := []string{}
+	for n := range trees {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// containsType tells if types contains r.
+func containsType(types []reflect.Type, r reflect.Type) bool {
+	for _, t := range types {
+		if t == r {
+			return true
+		}
+	}
+	return false
+}
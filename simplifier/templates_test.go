@@ -0,0 +1,159 @@
+package simplifier_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/mh-cbon/template-tree-simplifier/funcmap"
+	"github.com/mh-cbon/template-tree-simplifier/simplifier"
+)
+
+type tplPage struct {
+	Title string
+	Item  type2
+	Other type3
+}
+
+func TestTemplates(t *testing.T) {
+	//-
+	defFuncs := template.FuncMap{
+		"up":                 strings.ToUpper,
+		"browsePropertyPath": funcmap.BrowsePropertyPath,
+	}
+	data := tplPage{Title: "title", Item: type2{Some: "item"}}
+
+	trees := func(tpl *template.Template) map[string]*parse.Tree {
+		ret := map[string]*parse.Tree{}
+		for _, t := range tpl.Templates() {
+			if t.Tree != nil {
+				ret[t.Name()] = t.Tree
+			}
+		}
+		return ret
+	}
+
+	t.Run("Transform checks a template with the dot it is given", func(t *testing.T) {
+		tplContent := `{{up .Title}}{{template "row" .Item}}{{define "row"}}{{up .Some}}{{end}}`
+		tpl := template.Must(template.New("").Funcs(defFuncs).Parse(tplContent))
+		expected, err := exectemplate(tpl, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		warnings, err := simplifier.TransformE(tpl, data, defFuncs)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if len(warnings) > 0 {
+			t.Errorf("unexpected warnings %v", warnings)
+		}
+		got, err := exectemplate(tpl, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected {
+			t.Errorf("unexpected output, expected=%q, got=%q", expected, got)
+		}
+	})
+
+	t.Run("TypeCheckTemplates checks a template once per dot type", func(t *testing.T) {
+		tplContent := `{{template "row" .Item}}{{template "row" .Other}}{{template "row" .Item}}{{define "row"}}{{$x := .Some}}{{end}}`
+		tpl := template.Must(template.New("").Funcs(defFuncs).Parse(tplContent))
+		states, warnings := simplifier.TypeCheckTemplates(trees(tpl), "", data, defFuncs)
+		if len(warnings) > 0 {
+			t.Errorf("unexpected warnings %v", warnings)
+		}
+		if len(states[""]) != 1 {
+			t.Fatalf("expected the root template to be checked once, got %v", len(states[""]))
+		}
+		calls := states[""][0].Calls()
+		if len(calls) != 3 || calls[0].Name != "row" || calls[1].Dot != reflect.TypeOf(type3{}) {
+			t.Errorf("unexpected calls %v", calls)
+		}
+		rows := states["row"]
+		if len(rows) != 2 {
+			t.Fatalf("expected the row template to be checked twice, got %v", len(rows))
+		}
+		for i, expected := range []reflect.Type{reflect.TypeOf(""), reflect.TypeOf(type2{})} {
+			rows[i].Enter()
+			if got := rows[i].GetVar("$x"); got != expected {
+				t.Errorf("check(%v): unexpected type of $x, expected=%v, got=%v", i, expected, got)
+			}
+		}
+	})
+
+	t.Run("TransformE rejects a template called with different dot types", func(t *testing.T) {
+		tplContent := `{{template "row" .Item}}{{template "row" .Other}}{{define "row"}}{{$x := .Some}}{{end}}`
+		tpl := template.Must(template.New("").Funcs(defFuncs).Parse(tplContent))
+		_, err := simplifier.TransformE(tpl, data, defFuncs)
+		var dotErr *simplifier.TemplateDotTypeError
+		if !errors.As(err, &dotErr) {
+			t.Fatalf("expected a *TemplateDotTypeError, got %T %v", err, err)
+		}
+		if dotErr.Name != "row" || dotErr.Type != reflect.TypeOf(type2{}) || dotErr.Called != reflect.TypeOf(type3{}) {
+			t.Errorf("unexpected error %v", dotErr)
+		}
+		var diag *simplifier.Diagnostic
+		if errors.As(err, &diag) && diag.Col < 24 {
+			t.Errorf("expected the error to be located at the second call, got %v", diag)
+		}
+		// the templates are rejected before any of them is transformed.
+		if got := tpl.Tree.Root.String(); got != tplContent[:strings.Index(tplContent, "{{define")] {
+			t.Errorf("expected the template to be left untouched, got %v", got)
+		}
+	})
+
+	t.Run("Transform transforms every template of a set made by ParseFiles with the dot it is given", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "page.tpl")
+		tplContent := `{{.In.Any.k.Some}}{{define "row"}}{{up .In.Any.k.Some}}{{end}}`
+		if err := os.WriteFile(file, []byte(tplContent), 0644); err != nil {
+			t.Fatal(err)
+		}
+		tpl := template.Must(template.New("").Funcs(defFuncs).ParseFiles(file))
+		data := type18{In: type12{Any: map[string]interface{}{"k": type2{Some: "v"}}}}
+		warnings, err := simplifier.TransformE(tpl, data, defFuncs)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if len(warnings) > 0 {
+			t.Errorf("unexpected warnings %v", warnings)
+		}
+		for _, name := range []string{"page.tpl", "row"} {
+			page := tpl.Lookup(name)
+			if got := page.Tree.Root.String(); !strings.Contains(got, `browsePropertyPath .In.Any "k.Some"`) {
+				t.Errorf("expected %v to be unholed, got %v", name, got)
+			}
+			got, err := exectemplate(page, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := map[string]string{"page.tpl": "v", "row": "V"}[name]; got != expected {
+				t.Errorf("unexpected output of %v, expected=%q, got=%q", name, expected, got)
+			}
+		}
+	})
+
+	t.Run("TypeCheckTemplates reports the templates never called", func(t *testing.T) {
+		tplContent := `{{template "row" .Item}}{{define "row"}}{{.Some}}{{end}}{{define "unused"}}{{.Nope}}{{end}}`
+		tpl := template.Must(template.New("").Funcs(defFuncs).Parse(tplContent))
+		states, warnings := simplifier.TypeCheckTemplates(trees(tpl), "", data, defFuncs)
+		if len(warnings) != 1 {
+			t.Fatalf("expected a warning, got %v", warnings)
+		}
+		var uncalled *simplifier.UncalledTemplateError
+		if !errors.As(warnings[0], &uncalled) || uncalled.Name != "unused" {
+			t.Errorf("expected an *UncalledTemplateError of unused, got %v", warnings[0])
+		}
+		if warnings[0].Severity != simplifier.SeverityWarning {
+			t.Errorf("expected a warning, got %v", warnings[0].Severity)
+		}
+		if len(states["unused"]) != 1 || states["unused"][0].RootDot() != nil {
+			t.Errorf("expected the unused template to be checked with an unknown dot")
+		}
+	})
+}
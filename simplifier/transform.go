@@ -1,40 +1,75 @@
 package simplifier
 
 import (
-	"fmt"
 	html "html/template"
+	"reflect"
 	text "text/template"
 	"text/template/parse"
 )
 
-// Transform fully simplify a template.
+// Transform fully simplify a template,
+// and the templates it calls.
 // it accepts *text.Template or *html.Template,
-// it panics if the value type is unexpected.
-func Transform(some interface{}, data interface{}, funcs map[string]interface{}) {
+// it panics if the value type is unexpected,
+// see TransformE for an error returning version.
+// The template is transformed with data as its dot,
+// the templates it calls are transformed with the type of the dot they are given,
+// a template called with different dot types is rejected, see TypeCheckTemplates.
+// It returns a warning for each template which is never called,
+// those are transformed with an unknown dot type.
+// When the template has no tree, such as the root of a set made by ParseFiles,
+// every template of the set is transformed with data as its dot.
+// The templates are type checked first, none is transformed when one of them is rejected.
+func Transform(some interface{}, data interface{}, funcs map[string]interface{}) []*Diagnostic {
+	trees := templateTrees("Transform", some)
+	name := ""
 	if t, ok := some.(*text.Template); ok {
-		for _, tpl := range t.Templates() {
-			if tpl.Tree != nil {
-				TransformTree(tpl.Tree, data, funcs)
-			}
-		}
-
+		name = t.Name()
 	} else if h, ok := some.(*html.Template); ok {
-		for _, tpl := range h.Templates() {
-			if tpl.Tree != nil {
-				TransformTree(tpl.Tree, data, funcs)
-			}
-		}
-	} else {
-		err := fmt.Errorf("Transform: unhandled template type %T", some)
-		panic(err)
+		name = h.Name()
+	}
+	dots := map[string]reflect.Type{}
+	warnings := walkTemplates(trees, name, reflect.TypeOf(data), false, func(name string, dot reflect.Type) *State {
+		dots[name] = dot
+		s, _ := typeCheckDot(trees[name], dot, funcs, false)
+		return s
+	})
+	for _, n := range sortedNames(trees) {
+		transformTree(trees[n], dots[n], funcs)
 	}
+	return warnings
 }
 
 // TransformTree fully simplify a template Tree.
+// The returned State provides a SourceMap of the simplified tree
+// back to the original template source.
 func TransformTree(tree *parse.Tree, data interface{}, funcs map[string]interface{}) *State {
+	return transformTree(tree, reflect.TypeOf(data), funcs)
+}
+
+// transformTree is TransformTree with the type of the dot.
+func transformTree(tree *parse.Tree, dot reflect.Type, funcs map[string]interface{}) *State {
+	sourceMap := newSourceMap(tree)
 	Unshadow(tree)
-	Simplify(tree)
-	typeCheck := TypeCheck(tree, data, funcs)
+	simplify := &treeSimplifier{}
+	simplify.process(tree)
+	typeCheck, _ := typeCheckDot(tree, dot, funcs, false)
 	Unhole(tree, typeCheck, funcs)
+	sourceMap.index(tree, simplify.decls)
+	typeCheck.sourceMap = sourceMap
 	return typeCheck
 }
+
+// TransformE is like Transform,
+// but it returns an error rather than panicking.
+func TransformE(some interface{}, data interface{}, funcs map[string]interface{}) (warnings []*Diagnostic, err error) {
+	defer recoverError(&err)
+	return Transform(some, data, funcs), nil
+}
+
+// TransformTreeE is like TransformTree,
+// but it returns an error rather than panicking.
+func TransformTreeE(tree *parse.Tree, data interface{}, funcs map[string]interface{}) (state *State, err error) {
+	defer recoverError(&err)
+	return TransformTree(tree, data, funcs), nil
+}
@@ -2,6 +2,7 @@ package simplifier
 
 import (
 	"fmt"
+	"reflect"
 	// "github.com/mh-cbon/print-template-tree/printer"
 	"text/template/parse"
 )
@@ -13,14 +14,26 @@ func Simplify(tree *parse.Tree) {
 	s.process(tree)
 }
 
+// SimplifyE is like Simplify,
+// but it returns an error rather than panicking.
+func SimplifyE(tree *parse.Tree) (err error) {
+	defer recoverError(&err)
+	Simplify(tree)
+	return nil
+}
+
 // treeSimplifier holds,
 // a nodesDepth a stack of node supposingly it is possible to add Action before (if, range, with, action),
 // the tree to modify
-// vars an int to keep track of declared variable.
+// vars an int to keep track of declared variable,
+// proto an ActionNode of the tree, or of a stub, the new ActionNode are copied from it,
+// decls the nodes each new variable was made of.
 type treeSimplifier struct {
 	nodesDepth []parse.Node
 	tree       *parse.Tree
 	vars       int
+	proto      *parse.ActionNode
+	decls      map[string][]parse.Node
 }
 
 // enter pushes a node on the stack of *interesting* nodes.
@@ -44,9 +57,23 @@ func (t *treeSimplifier) reset() {
 	t.nodesDepth = make([]parse.Node, 0)
 }
 
+// error reports err located at node, it stops the processing.
+func (t *treeSimplifier) error(node parse.Node, err error) {
+	panic(newDiagnostic(t.tree, node, SeverityError, err))
+}
+
 // process the tree until no more simplification can be done.
 func (t *treeSimplifier) process(tree *parse.Tree) {
 	t.tree = tree
+	t.proto = findActionNode(tree.Root)
+	if t.proto == nil {
+		proto, err := stubActionNode(tree)
+		if err != nil {
+			t.error(tree.Root, err)
+		}
+		t.proto = proto
+	}
+	t.decls = map[string][]parse.Node{}
 	renameVariables(tree.Root)
 	for t.browseNodes(tree.Root) {
 		// printer.PrintContent(tree) // useful for debug sometimes.
@@ -61,6 +88,11 @@ func (t *treeSimplifier) createVarName() string {
 	return name
 }
 
+// declare records the nodes a new variable is made of.
+func (t *treeSimplifier) declare(name string, nodes ...parse.Node) {
+	t.decls[name] = nodes
+}
+
 // browseNodes recursively, it returns true when the tree was modified, false otherwise.
 func (t *treeSimplifier) browseNodes(l interface{}) bool {
 	switch node := l.(type) {
@@ -104,6 +136,9 @@ func (t *treeSimplifier) browseNodes(l interface{}) bool {
 		}
 
 	case *parse.CommandNode:
+		if t.simplifyCommandNode(node, t.current()) {
+			return true
+		}
 		for _, child := range node.Args {
 			if t.browseNodes(child) {
 				return true
@@ -180,16 +215,25 @@ func (t *treeSimplifier) browseNodes(l interface{}) bool {
 		//pass
 	case *parse.BoolNode:
 		//pass
+	case *parse.NilNode:
+		//pass
+	case *parse.BreakNode:
+		//pass
+	case *parse.ContinueNode:
+		//pass
 	case *parse.DotNode:
 		//pass
 	case *parse.FieldNode:
 		//pass
 	case *parse.TextNode:
 		//pass
+	case *parse.CommentNode:
+		//pass
 
 	default:
-		err := fmt.Errorf("treeSimplifier.browseNodes: unhandled node type\n%v\n%#v", node, node)
-		panic(err)
+		n, _ := node.(parse.Node)
+		err := &UnhandledNodeError{Op: "treeSimplifier.browseNodes", Node: n}
+		t.error(n, err)
 	}
 	return false
 }
@@ -216,21 +260,19 @@ func (t *treeSimplifier) simplifyActionNode(node *parse.ActionNode) bool {
 		case *parse.PipeNode:
 			varName := t.createVarName()
 			// create a new action node
-			newAction := createAVariablePipeActionFromCmd(varName, nil)
-			for _, c := range node.Pipe.Cmds[:j-1] {
-				newAction.Pipe.Cmds = append(newAction.Pipe.Cmds, c)
-			}
+			newAction := t.createAVariablePipeActionFromCmd(varName, node.Pipe.Cmds[:j-1]...)
 			// replace the cmd with the new varnode
-			newCmd := createACmdNode()
-			newCmd.Args = append(newCmd.Args, createAVariableNode(varName))
+			newCmd := createACmdNode(pcmd)
+			newCmd.Args = append(newCmd.Args, createAVariableNode(varName, pcmd))
 			node.Pipe.Cmds = []*parse.CommandNode{newCmd, lastCmd}
 			// insert the new action node
-			if insertActionBeforeRef(t.tree.Root, node, newAction) == false {
-				err := fmt.Errorf(
-					"treeSimplifier.simplifyActionNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-					newAction, newAction,
-					node, node)
-				panic(err)
+			if t.insertActionBefore(node, newAction) == false {
+				err := &InsertFailedError{
+					Op:   "treeSimplifier.simplifyActionNode",
+					Node: newAction,
+					Ref:  node,
+				}
+				t.error(node, err)
 			}
 			return true
 		case *parse.FieldNode:
@@ -239,21 +281,19 @@ func (t *treeSimplifier) simplifyActionNode(node *parse.ActionNode) bool {
 			if len(pcmd.Args) > 1 {
 				varName := t.createVarName()
 				// create a new action node
-				newAction := createAVariablePipeActionFromCmd(varName, nil)
-				for _, c := range node.Pipe.Cmds[:j-1] {
-					newAction.Pipe.Cmds = append(newAction.Pipe.Cmds, c)
-				}
+				newAction := t.createAVariablePipeActionFromCmd(varName, node.Pipe.Cmds[:j-1]...)
 				// replace the cmd with the new varnode
-				newCmd := createACmdNode()
-				newCmd.Args = append(newCmd.Args, createAVariableNode(varName))
+				newCmd := createACmdNode(pcmd)
+				newCmd.Args = append(newCmd.Args, createAVariableNode(varName, pcmd))
 				node.Pipe.Cmds = []*parse.CommandNode{newCmd, lastCmd}
 				// insert the new action node
-				if insertActionBeforeRef(t.tree.Root, node, newAction) == false {
-					err := fmt.Errorf(
-						"treeSimplifier.simplifyActionNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-						newAction, newAction,
-						node, node)
-					panic(err)
+				if t.insertActionBefore(node, newAction) == false {
+					err := &InsertFailedError{
+						Op:   "treeSimplifier.simplifyActionNode",
+						Node: newAction,
+						Ref:  node,
+					}
+					t.error(node, err)
 				}
 				return true
 			}
@@ -263,21 +303,19 @@ func (t *treeSimplifier) simplifyActionNode(node *parse.ActionNode) bool {
 			if len(pcmd.Args) > 1 {
 				varName := t.createVarName()
 				// create a new action node
-				newAction := createAVariablePipeActionFromCmd(varName, nil)
-				for _, c := range node.Pipe.Cmds[:j-1] {
-					newAction.Pipe.Cmds = append(newAction.Pipe.Cmds, c)
-				}
+				newAction := t.createAVariablePipeActionFromCmd(varName, node.Pipe.Cmds[:j-1]...)
 				// replace the cmd with the new varnode
-				newCmd := createACmdNode()
-				newCmd.Args = append(newCmd.Args, createAVariableNode(varName))
+				newCmd := createACmdNode(pcmd)
+				newCmd.Args = append(newCmd.Args, createAVariableNode(varName, pcmd))
 				node.Pipe.Cmds = []*parse.CommandNode{newCmd, lastCmd}
 				// insert the new action node
-				if insertActionBeforeRef(t.tree.Root, node, newAction) == false {
-					err := fmt.Errorf(
-						"treeSimplifier.simplifyActionNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-						newAction, newAction,
-						node, node)
-					panic(err)
+				if t.insertActionBefore(node, newAction) == false {
+					err := &InsertFailedError{
+						Op:   "treeSimplifier.simplifyActionNode",
+						Node: newAction,
+						Ref:  node,
+					}
+					t.error(node, err)
 				}
 				return true
 			}
@@ -295,18 +333,19 @@ func (t *treeSimplifier) simplifyActionNode(node *parse.ActionNode) bool {
 		_, pipeToMove := getPipeFollowingIdentifier(cmd)
 		if pipeToMove != nil {
 			varName := t.createVarName()
-			varNode := createAVariableNode(varName)
+			varNode := createAVariableNode(varName, pipeToMove)
 			if replacePipeWithVar(cmd, pipeToMove, varNode) == false {
-				err := fmt.Errorf("treeSimplifier.simplifyActionNode: failed to replace Pipe with Var in Cmd\n%v\n%#v", cmd, cmd)
-				panic(err)
+				err := &UnhandledNodeError{Op: "treeSimplifier.simplifyActionNode", Node: cmd, Reason: "failed to replace Pipe with Var in Cmd"}
+				t.error(cmd, err)
 			}
-			newAction := createAVariablePipeAction(varName, pipeToMove)
-			if insertActionBeforeRef(t.tree.Root, node, newAction) == false {
-				err := fmt.Errorf(
-					"treeSimplifier.simplifyActionNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-					newAction, newAction,
-					node, node)
-				panic(err)
+			newAction := t.createAVariablePipeAction(varName, pipeToMove)
+			if t.insertActionBefore(node, newAction) == false {
+				err := &InsertFailedError{
+					Op:   "treeSimplifier.simplifyActionNode",
+					Node: newAction,
+					Ref:  node,
+				}
+				t.error(node, err)
 			}
 			return true
 		}
@@ -328,16 +367,18 @@ func (t *treeSimplifier) simplifyActionNode(node *parse.ActionNode) bool {
 		if validNode {
 			// transform this node into an asignment
 			varName := t.createVarName()
-			varNode := createAVariableNode(varName)
+			varNode := createAVariableNode(varName, node.Pipe)
 			node.Pipe.Decl = append(node.Pipe.Decl, varNode)
+			t.declare(varName, node.Pipe)
 			// add a new print action node
-			newAction := createActionNodeToPrintVar(varName)
-			if insertActionAfterRef(t.tree.Root, node, newAction) == false {
-				err := fmt.Errorf(
-					"treeSimplifier.simplifyActionNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-					newAction, newAction,
-					node, node)
-				panic(err)
+			newAction := t.createActionNodeToPrintVar(varName, node)
+			if t.insertActionAfter(node, newAction) == false {
+				err := &InsertFailedError{
+					Op:   "treeSimplifier.simplifyActionNode",
+					Node: newAction,
+					Ref:  node,
+				}
+				t.error(node, err)
 			}
 			return true
 		}
@@ -357,33 +398,35 @@ func (t *treeSimplifier) simplifyActionNode(node *parse.ActionNode) bool {
 				if field, ok := arg.(*parse.FieldNode); ok {
 					// create a new assignment of the fieldNode
 					varName := t.createVarName()
-					newAction := createAVariableAssignmentOfFieldNode(varName, field)
+					newAction := t.createAVariableAssignmentOfFieldNode(varName, field)
 					// insert the new action before this node
-					if insertActionBeforeRef(t.tree.Root, node, newAction) == false {
-						err := fmt.Errorf(
-							"treeSimplifier.simplifyActionNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-							newAction, newAction,
-							node, node)
-						panic(err)
+					if t.insertActionBefore(node, newAction) == false {
+						err := &InsertFailedError{
+							Op:   "treeSimplifier.simplifyActionNode",
+							Node: newAction,
+							Ref:  node,
+						}
+						t.error(node, err)
 					}
 					// replace the fieldNode arg with a variable node
-					varNode := createAVariableNode(varName)
+					varNode := createAVariableNode(varName, field)
 					node.Pipe.Cmds[0].Args[i] = varNode
 					return true
 				} else if varnode, ok := arg.(*parse.VariableNode); ok && len(varnode.Ident) > 1 {
 					// create a new assignment of the VariableNode
 					varName := t.createVarName()
-					newAction := createAVariableAssignmentOfVariableNode(varName, varnode)
+					newAction := t.createAVariableAssignmentOfVariableNode(varName, varnode)
 					// insert the new action before this node
-					if insertActionBeforeRef(t.tree.Root, node, newAction) == false {
-						err := fmt.Errorf(
-							"treeSimplifier.simplifyActionNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-							newAction, newAction,
-							node, node)
-						panic(err)
+					if t.insertActionBefore(node, newAction) == false {
+						err := &InsertFailedError{
+							Op:   "treeSimplifier.simplifyActionNode",
+							Node: newAction,
+							Ref:  node,
+						}
+						t.error(node, err)
 					}
 					// replace the fieldNode arg with a variable node
-					varNode := createAVariableNode(varName)
+					varNode := createAVariableNode(varName, varnode)
 					node.Pipe.Cmds[0].Args[i] = varNode
 					return true
 				}
@@ -403,15 +446,16 @@ func (t *treeSimplifier) simplifyIfNode(node *parse.IfNode) bool {
 	if len(node.Pipe.Cmds) > 0 && len(node.Pipe.Cmds[0].Args) == 1 {
 		if field, ok := node.Pipe.Cmds[0].Args[0].(*parse.FieldNode); ok {
 			varName := t.createVarName()
-			varNode := createAVariableNode(varName)
-			newAction := createAVariableAssignmentOfFieldNode(varName, field)
+			varNode := createAVariableNode(varName, field)
+			newAction := t.createAVariableAssignmentOfFieldNode(varName, field)
 			node.Pipe.Cmds[0].Args[0] = varNode
-			if insertActionBeforeRef(t.tree.Root, node, newAction) == false {
-				err := fmt.Errorf(
-					"treeSimplifier.simplifyIfNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-					newAction, newAction,
-					node, node)
-				panic(err)
+			if t.insertActionBefore(node, newAction) == false {
+				err := &InsertFailedError{
+					Op:   "treeSimplifier.simplifyIfNode",
+					Node: newAction,
+					Ref:  node,
+				}
+				t.error(node, err)
 			}
 			return true
 		}
@@ -429,15 +473,16 @@ func (t *treeSimplifier) simplifyTemplateNode(node *parse.TemplateNode) bool {
 	if len(node.Pipe.Cmds) > 0 && len(node.Pipe.Cmds[0].Args) == 1 {
 		if field, ok := node.Pipe.Cmds[0].Args[0].(*parse.FieldNode); ok {
 			varName := t.createVarName()
-			varNode := createAVariableNode(varName)
-			newAction := createAVariableAssignmentOfFieldNode(varName, field)
+			varNode := createAVariableNode(varName, field)
+			newAction := t.createAVariableAssignmentOfFieldNode(varName, field)
 			node.Pipe.Cmds[0].Args[0] = varNode
-			if insertActionBeforeRef(t.tree.Root, node, newAction) == false {
-				err := fmt.Errorf(
-					"treeSimplifier.simplifyIfNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-					newAction, newAction,
-					node, node)
-				panic(err)
+			if t.insertActionBefore(node, newAction) == false {
+				err := &InsertFailedError{
+					Op:   "treeSimplifier.simplifyIfNode",
+					Node: newAction,
+					Ref:  node,
+				}
+				t.error(node, err)
 			}
 			return true
 		}
@@ -455,15 +500,16 @@ func (t *treeSimplifier) simplifyWithNode(node *parse.WithNode) bool {
 		*/
 		if field, ok := node.Pipe.Cmds[0].Args[0].(*parse.FieldNode); ok {
 			varName := t.createVarName()
-			varNode := createAVariableNode(varName)
-			newAction := createAVariableAssignmentOfFieldNode(varName, field)
+			varNode := createAVariableNode(varName, field)
+			newAction := t.createAVariableAssignmentOfFieldNode(varName, field)
 			node.Pipe.Cmds[0].Args[0] = varNode
-			if insertActionBeforeRef(t.tree.Root, node, newAction) == false {
-				err := fmt.Errorf(
-					"treeSimplifier.simplifyWithNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-					newAction, newAction,
-					node, node)
-				panic(err)
+			if t.insertActionBefore(node, newAction) == false {
+				err := &InsertFailedError{
+					Op:   "treeSimplifier.simplifyWithNode",
+					Node: newAction,
+					Ref:  node,
+				}
+				t.error(node, err)
 			}
 			return true
 
@@ -474,15 +520,16 @@ func (t *treeSimplifier) simplifyWithNode(node *parse.WithNode) bool {
 			*/
 		} else if dot, ok := node.Pipe.Cmds[0].Args[0].(*parse.DotNode); ok {
 			varName := t.createVarName()
-			varNode := createAVariableNode(varName)
-			newAction := createAVariableAssignmentOfDotNode(varName, dot)
+			varNode := createAVariableNode(varName, dot)
+			newAction := t.createAVariableAssignmentOfDotNode(varName, dot)
 			node.Pipe.Cmds[0].Args[0] = varNode
-			if insertActionBeforeRef(t.tree.Root, node, newAction) == false {
-				err := fmt.Errorf(
-					"treeSimplifier.simplifyWithNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-					newAction, newAction,
-					node, node)
-				panic(err)
+			if t.insertActionBefore(node, newAction) == false {
+				err := &InsertFailedError{
+					Op:   "treeSimplifier.simplifyWithNode",
+					Node: newAction,
+					Ref:  node,
+				}
+				t.error(node, err)
 			}
 			return true
 
@@ -493,15 +540,16 @@ func (t *treeSimplifier) simplifyWithNode(node *parse.WithNode) bool {
 			*/
 		} else if variable, ok := node.Pipe.Cmds[0].Args[0].(*parse.VariableNode); ok && len(variable.Ident) > 1 {
 			varName := t.createVarName()
-			varNode := createAVariableNode(varName)
-			newAction := createAVariableAssignmentOfVariableNode(varName, variable)
+			varNode := createAVariableNode(varName, variable)
+			newAction := t.createAVariableAssignmentOfVariableNode(varName, variable)
 			node.Pipe.Cmds[0].Args[0] = varNode
-			if insertActionBeforeRef(t.tree.Root, node, newAction) == false {
-				err := fmt.Errorf(
-					"treeSimplifier.simplifyWithNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-					newAction, newAction,
-					node, node)
-				panic(err)
+			if t.insertActionBefore(node, newAction) == false {
+				err := &InsertFailedError{
+					Op:   "treeSimplifier.simplifyWithNode",
+					Node: newAction,
+					Ref:  node,
+				}
+				t.error(node, err)
 			}
 			return true
 		}
@@ -519,15 +567,16 @@ func (t *treeSimplifier) simplifyRangeNode(node *parse.RangeNode) bool {
 		*/
 		if field, ok := node.Pipe.Cmds[0].Args[0].(*parse.FieldNode); ok {
 			varName := t.createVarName()
-			varNode := createAVariableNode(varName)
-			newAction := createAVariableAssignmentOfFieldNode(varName, field)
+			varNode := createAVariableNode(varName, field)
+			newAction := t.createAVariableAssignmentOfFieldNode(varName, field)
 			node.Pipe.Cmds[0].Args[0] = varNode
-			if insertActionBeforeRef(t.tree.Root, node, newAction) == false {
-				err := fmt.Errorf(
-					"treeSimplifier.simplifyRangeNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-					newAction, newAction,
-					node, node)
-				panic(err)
+			if t.insertActionBefore(node, newAction) == false {
+				err := &InsertFailedError{
+					Op:   "treeSimplifier.simplifyRangeNode",
+					Node: newAction,
+					Ref:  node,
+				}
+				t.error(node, err)
 			}
 			return true
 
@@ -538,15 +587,16 @@ func (t *treeSimplifier) simplifyRangeNode(node *parse.RangeNode) bool {
 			*/
 		} else if dot, ok := node.Pipe.Cmds[0].Args[0].(*parse.DotNode); ok {
 			varName := t.createVarName()
-			varNode := createAVariableNode(varName)
-			newAction := createAVariableAssignmentOfDotNode(varName, dot)
+			varNode := createAVariableNode(varName, dot)
+			newAction := t.createAVariableAssignmentOfDotNode(varName, dot)
 			node.Pipe.Cmds[0].Args[0] = varNode
-			if insertActionBeforeRef(t.tree.Root, node, newAction) == false {
-				err := fmt.Errorf(
-					"treeSimplifier.simplifyRangeNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-					newAction, newAction,
-					node, node)
-				panic(err)
+			if t.insertActionBefore(node, newAction) == false {
+				err := &InsertFailedError{
+					Op:   "treeSimplifier.simplifyRangeNode",
+					Node: newAction,
+					Ref:  node,
+				}
+				t.error(node, err)
 			}
 			return true
 
@@ -557,15 +607,16 @@ func (t *treeSimplifier) simplifyRangeNode(node *parse.RangeNode) bool {
 			*/
 		} else if variable, ok := node.Pipe.Cmds[0].Args[0].(*parse.VariableNode); ok && len(variable.Ident) > 1 {
 			varName := t.createVarName()
-			varNode := createAVariableNode(varName)
-			newAction := createAVariableAssignmentOfVariableNode(varName, variable)
+			varNode := createAVariableNode(varName, variable)
+			newAction := t.createAVariableAssignmentOfVariableNode(varName, variable)
 			node.Pipe.Cmds[0].Args[0] = varNode
-			if insertActionBeforeRef(t.tree.Root, node, newAction) == false {
-				err := fmt.Errorf(
-					"treeSimplifier.simplifyRangeNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-					newAction, newAction,
-					node, node)
-				panic(err)
+			if t.insertActionBefore(node, newAction) == false {
+				err := &InsertFailedError{
+					Op:   "treeSimplifier.simplifyRangeNode",
+					Node: newAction,
+					Ref:  node,
+				}
+				t.error(node, err)
 			}
 			return true
 		}
@@ -589,17 +640,17 @@ func (t *treeSimplifier) variablifyActionNode(node *parse.ActionNode) bool {
 		if _, ok := node.Pipe.Cmds[0].Args[0].(*parse.IdentifierNode); ok {
 			varname := t.createVarName()
 			//transform the print into a variable assignment
-			node.Pipe.Decl = append(node.Pipe.Decl, &parse.VariableNode{
-				Ident: []string{varname},
-			})
+			node.Pipe.Decl = append(node.Pipe.Decl, createAVariableNode(varname, node.Pipe))
+			t.declare(varname, node.Pipe)
 			// add a print of the variable
-			newAction := createActionNodeToPrintVar(varname)
-			if insertActionAfterRef(t.tree.Root, node, newAction) == false {
-				err := fmt.Errorf(
-					"treeSimplifier.variablifyActionNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-					newAction, newAction,
-					node, node)
-				panic(err)
+			newAction := t.createActionNodeToPrintVar(varname, node)
+			if t.insertActionAfter(node, newAction) == false {
+				err := &InsertFailedError{
+					Op:   "treeSimplifier.variablifyActionNode",
+					Node: newAction,
+					Ref:  node,
+				}
+				t.error(node, err)
 			}
 			return true
 		}
@@ -632,18 +683,19 @@ func (t *treeSimplifier) simplifyPipeNode(node *parse.PipeNode, ref parse.Node)
 		firstCmdIndex := getCmdIndex(firstCmd, node)
 		if firstCmdIndex > -1 {
 			varName := t.createVarName()
-			varNode := createAVariableNode(varName)
+			varNode := createAVariableNode(varName, firstCmd)
 			if replaceCmdWithVar(node, firstCmd, varNode) == false {
-				err := fmt.Errorf("treeSimplifier.simplifyPipeNode: failed to replace Pipe with Var in Cmd\n%v\n%#v", firstCmd, firstCmd)
-				panic(err)
+				err := &UnhandledNodeError{Op: "treeSimplifier.simplifyPipeNode", Node: firstCmd, Reason: "failed to replace Pipe with Var in Cmd"}
+				t.error(firstCmd, err)
 			}
-			newAction := createAVariablePipeActionFromCmd(varName, firstCmd)
-			if insertActionBeforeRef(t.tree.Root, ref, newAction) == false {
-				err := fmt.Errorf(
-					"treeSimplifier.simplifyPipeNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-					newAction, newAction,
-					node, node)
-				panic(err)
+			newAction := t.createAVariablePipeActionFromCmd(varName, firstCmd)
+			if t.insertActionBefore(ref, newAction) == false {
+				err := &InsertFailedError{
+					Op:   "treeSimplifier.simplifyPipeNode",
+					Node: newAction,
+					Ref:  node,
+				}
+				t.error(node, err)
 			}
 			return true
 		}
@@ -675,18 +727,18 @@ func (t *treeSimplifier) simplifyPipeNode(node *parse.PipeNode, ref parse.Node)
 			if len(cmd.Args) > 0 {
 				if _, ok := cmd.Args[0].(*parse.IdentifierNode); ok {
 					varName := t.createVarName()
-					varNode := createAVariableNode(varName)
-					newAction := createAVariablePipeAction(varName, node)
-					newCmd := &parse.CommandNode{}
-					newCmd.NodeType = parse.NodeCommand
+					varNode := createAVariableNode(varName, node)
+					newAction := t.createAVariablePipeAction(varName, node)
+					newCmd := createACmdNode(cmd)
 					newCmd.Args = append(newCmd.Args, varNode)
 					node.Cmds = append(node.Cmds[:0], newCmd)
-					if insertActionBeforeRef(t.tree.Root, ref, newAction) == false {
-						err := fmt.Errorf(
-							"treeSimplifier.simplifyPipeNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-							newAction, newAction,
-							ref, ref)
-						panic(err)
+					if t.insertActionBefore(ref, newAction) == false {
+						err := &InsertFailedError{
+							Op:   "treeSimplifier.simplifyPipeNode",
+							Node: newAction,
+							Ref:  ref,
+						}
+						t.error(ref, err)
 					}
 					return true
 				}
@@ -705,18 +757,19 @@ func (t *treeSimplifier) simplifyPipeNode(node *parse.PipeNode, ref parse.Node)
 			_, pipeToMove := getPipeFollowingIdentifier(cmd)
 			if pipeToMove != nil {
 				varName := t.createVarName()
-				varNode := createAVariableNode(varName)
+				varNode := createAVariableNode(varName, pipeToMove)
 				if replacePipeWithVar(cmd, pipeToMove, varNode) == false {
-					err := fmt.Errorf("treeSimplifier.simplifyPipeNode: failed to replace Pipe with Var in Cmd\n%v\n%#v", cmd, cmd)
-					panic(err)
+					err := &UnhandledNodeError{Op: "treeSimplifier.simplifyPipeNode", Node: cmd, Reason: "failed to replace Pipe with Var in Cmd"}
+					t.error(cmd, err)
 				}
-				newAction := createAVariablePipeAction(varName, pipeToMove)
-				if insertActionBeforeRef(t.tree.Root, ref, newAction) == false {
-					err := fmt.Errorf(
-						"treeSimplifier.simplifyPipeNode: failed to insert the new Action node\n%v\n%#v\nreference node was\n%v\n%#v",
-						newAction, newAction,
-						ref, ref)
-					panic(err)
+				newAction := t.createAVariablePipeAction(varName, pipeToMove)
+				if t.insertActionBefore(ref, newAction) == false {
+					err := &InsertFailedError{
+						Op:   "treeSimplifier.simplifyPipeNode",
+						Node: newAction,
+						Ref:  ref,
+					}
+					t.error(ref, err)
 				}
 				return true
 			}
@@ -740,8 +793,161 @@ func (t *treeSimplifier) simplifyPipeNode(node *parse.PipeNode, ref parse.Node)
 	return false
 }
 
+// simplifyCommandNode reduce complexity of CommandNode.
+func (t *treeSimplifier) simplifyCommandNode(node *parse.CommandNode, ref parse.Node) bool {
+	/*
+	  look for
+	  {{(index .Users 0).Name}}
+	  transform into
+	  {{$some := index .Users 0}}
+	  {{$some.Name}}
+	*/
+	for i, arg := range node.Args {
+		if chain, ok := arg.(*parse.ChainNode); ok {
+			varName := t.createVarName()
+			var newAction *parse.ActionNode
+			if pipe, ok := chain.Node.(*parse.PipeNode); ok {
+				newAction = t.createAVariablePipeAction(varName, pipe)
+			} else {
+				newAction = t.createAVariableAssignmentOfSomeNode(varName, chain.Node)
+			}
+			// replace the chain with a variable path
+			varNode := createAVariableNode(varName, chain)
+			varNode.Ident = append(varNode.Ident, chain.Field...)
+			node.Args[i] = varNode
+			if t.insertActionBefore(ref, newAction) == false {
+				err := &InsertFailedError{
+					Op:   "treeSimplifier.simplifyCommandNode",
+					Node: newAction,
+					Ref:  ref,
+				}
+				t.error(ref, err)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// insertActionBefore inserts newAction before ref.
+// When ref is a direct child of an enclosing branch, it is inserted into that list,
+// this is notably the case of {{else if}} and {{else with}},
+// which are the only node of the ElseList of the enclosing branch,
+// the new action then runs only when that else branch is reached.
+// Otherwise the whole tree is searched for ref.
+func (t *treeSimplifier) insertActionBefore(ref parse.Node, newAction *parse.ActionNode) bool {
+	if list := t.enclosingList(ref); list != nil {
+		return insertActionBeforeRef(list, ref, newAction)
+	}
+	return insertActionBeforeRef(t.tree.Root, ref, newAction)
+}
+
+// insertActionAfter inserts newAction after ref,
+// see insertActionBefore.
+func (t *treeSimplifier) insertActionAfter(ref parse.Node, newAction *parse.ActionNode) bool {
+	if list := t.enclosingList(ref); list != nil {
+		return insertActionAfterRef(list, ref, newAction)
+	}
+	return insertActionAfterRef(t.tree.Root, ref, newAction)
+}
+
+// enclosingList returns the List or ElseList of the branch enclosing ref
+// which directly contains ref.
+// It returns nil if ref is not in the stack of nodes, or not directly within a branch.
+func (t *treeSimplifier) enclosingList(ref parse.Node) *parse.ListNode {
+	for i := len(t.nodesDepth) - 1; i > 0; i-- {
+		if t.nodesDepth[i] != ref {
+			continue
+		}
+		var branch *parse.BranchNode
+		switch parent := t.nodesDepth[i-1].(type) {
+		case *parse.IfNode:
+			branch = &parent.BranchNode
+		case *parse.RangeNode:
+			branch = &parent.BranchNode
+		case *parse.WithNode:
+			branch = &parent.BranchNode
+		}
+		if branch == nil {
+			return nil
+		}
+		for _, list := range []*parse.ListNode{branch.List, branch.ElseList} {
+			if list == nil {
+				continue
+			}
+			for _, node := range list.Nodes {
+				if node == ref {
+					return list
+				}
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// findActionNode browses given node list until it can find an ActionNode.
+// It returns nil if the list does not contain any.
+func findActionNode(list *parse.ListNode) *parse.ActionNode {
+	if list == nil {
+		return nil
+	}
+	for _, node := range list.Nodes {
+		var found *parse.ActionNode
+		switch node := node.(type) {
+		case *parse.ActionNode:
+			return node
+		case *parse.IfNode:
+			if found = findActionNode(node.List); found == nil {
+				found = findActionNode(node.ElseList)
+			}
+		case *parse.RangeNode:
+			if found = findActionNode(node.List); found == nil {
+				found = findActionNode(node.ElseList)
+			}
+		case *parse.WithNode:
+			if found = findActionNode(node.List); found == nil {
+				found = findActionNode(node.ElseList)
+			}
+		}
+		if found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// stubActionNode returns the ActionNode of a {{.}} stub,
+// parsed with the delimiters of the tree, for a tree without any ActionNode.
+func stubActionNode(tree *parse.Tree) (*parse.ActionNode, error) {
+	left, right := treeDelims(tree)
+	stub, err := parse.New(tree.Name).Parse(left+"."+right, left, right, map[string]*parse.Tree{})
+	if err != nil {
+		return nil, &StubActionError{Op: "stubActionNode", LeftDelim: left, RightDelim: right, Err: err}
+	}
+	return stub.Root.Nodes[0].(*parse.ActionNode), nil
+}
+
+// treeDelims returns the delimiters tree was parsed with.
+// They are read from the unexported fields of parse.Tree,
+// the versions of parse without them print the nodes with the default delimiters, {{ and }},
+// those are returned when the fields are missing, or empty.
+func treeDelims(tree *parse.Tree) (string, string) {
+	left, right := "{{", "}}"
+	v := reflect.ValueOf(tree).Elem()
+	if f := v.FieldByName("leftDelim"); f.IsValid() && f.String() != "" {
+		left = f.String()
+	}
+	if f := v.FieldByName("rightDelim"); f.IsValid() && f.String() != "" {
+		right = f.String()
+	}
+	return left, right
+}
+
 // insertActionBeforeRef browses given node list until it can find ref node,
 // it then insert newAction before the ref node.
+// The new action is inserted right before ref, within the same list,
+// so a {{break}} or {{continue}} preceding ref skips both of them.
 // It returns false if it failed to insert the new node.
 func insertActionBeforeRef(list *parse.ListNode, ref parse.Node, newAction *parse.ActionNode) bool {
 	for i := 0; i < len(list.Nodes); i++ {
@@ -780,6 +986,8 @@ func insertActionBeforeRef(list *parse.ListNode, ref parse.Node, newAction *pars
 
 // insertActionAfterRef browses given node list until it can find ref node,
 // it then insert newAction after the ref node.
+// The new action is inserted right after ref, within the same list,
+// so a {{break}} or {{continue}} following ref skips both of them.
 // It returns false if it failed to insert the new node.
 func insertActionAfterRef(list *parse.ListNode, ref parse.Node, newAction *parse.ActionNode) bool {
 	for i := 0; i < len(list.Nodes); i++ {
@@ -816,48 +1024,53 @@ func insertActionAfterRef(list *parse.ListNode, ref parse.Node, newAction *parse
 	return false
 }
 
+// createAnActionNode creates a new ActionNode of the pipe,
+// positioned at the pipe.
+// As the tree of a node is unexported, the new node is copied
+// from an ActionNode of the tree, or from a stub parsed with its delimiters,
+// so that it is printed as the nodes of the tree being simplified.
+func (t *treeSimplifier) createAnActionNode(pipe *parse.PipeNode) *parse.ActionNode {
+	node := &parse.ActionNode{}
+	if t.proto != nil {
+		*node = *t.proto
+	}
+	node.NodeType = parse.NodeAction
+	node.Pos = pipe.Pos
+	node.Line = pipe.Line
+	node.Pipe = pipe
+	return node
+}
+
 // createAVariablePipeAction creates a new ActionNode as an assignment
 // of a PipeNode to a new variable node.
 // example:
 // {{ ("what" | up) | lower }}
 // the pipe to modify is: ("what" | up)
 // this func will create: {{$name := ("what" | up)}}
-func createAVariablePipeAction(name string, pipe *parse.PipeNode) *parse.ActionNode {
-	varNode := &parse.VariableNode{
-		NodeType: parse.NodeVariable,
-		Ident:    []string{name},
-	}
-	actionPipe := &parse.PipeNode{}
-	actionPipe.Decl = append(actionPipe.Decl, varNode)
+func (t *treeSimplifier) createAVariablePipeAction(name string, pipe *parse.PipeNode) *parse.ActionNode {
+	t.declare(name, pipe)
+	actionPipe := createAPipeNode(pipe)
+	actionPipe.Decl = append(actionPipe.Decl, createAVariableNode(name, pipe))
 	actionPipe.Cmds = append(actionPipe.Cmds, pipe.Cmds...)
-	node := &parse.ActionNode{
-		NodeType: parse.NodeAction,
-		Pipe:     actionPipe,
-	}
-	return node
+	return t.createAnActionNode(actionPipe)
 }
 
 // createAVariablePipeActionFromCmd creates a new ActionNode as an assignment
-// of a CommandNode to a new variable node.
+// of CommandNodes to a new variable node, positioned at the first command.
 // example:
 // {{ up "what" | lower }}
 // the command to modify is: up "what"
 // this func will create: {{$name := up "what" | lower}}
-func createAVariablePipeActionFromCmd(name string, cmd *parse.CommandNode) *parse.ActionNode {
-	varNode := &parse.VariableNode{
-		NodeType: parse.NodeVariable,
-		Ident:    []string{name},
-	}
-	actionPipe := &parse.PipeNode{}
-	actionPipe.Decl = append(actionPipe.Decl, varNode)
-	if cmd != nil {
-		actionPipe.Cmds = append(actionPipe.Cmds, cmd)
+func (t *treeSimplifier) createAVariablePipeActionFromCmd(name string, cmds ...*parse.CommandNode) *parse.ActionNode {
+	nodes := []parse.Node{}
+	for _, cmd := range cmds {
+		nodes = append(nodes, cmd)
 	}
-	node := &parse.ActionNode{
-		NodeType: parse.NodeAction,
-		Pipe:     actionPipe,
-	}
-	return node
+	t.declare(name, nodes...)
+	actionPipe := createAPipeNode(cmds[0])
+	actionPipe.Decl = append(actionPipe.Decl, createAVariableNode(name, cmds[0]))
+	actionPipe.Cmds = append(actionPipe.Cmds, cmds...)
+	return t.createAnActionNode(actionPipe)
 }
 
 // createAVariableAssignmentOfSomeNode creates a new ActionNode as an assignment
@@ -865,20 +1078,14 @@ func createAVariablePipeActionFromCmd(name string, cmd *parse.CommandNode) *pars
 // example:
 // {{ .Field.Node }}
 // this func will create: {{$name := .Field.Node }}
-func createAVariableAssignmentOfSomeNode(name string, node parse.Node) *parse.ActionNode {
-	varNode := &parse.VariableNode{
-		NodeType: parse.NodeVariable,
-		Ident:    []string{name},
-	}
-	actionPipe := &parse.PipeNode{}
-	actionPipe.Decl = append(actionPipe.Decl, varNode)
-	cmdNode := createACmdNode()
+func (t *treeSimplifier) createAVariableAssignmentOfSomeNode(name string, node parse.Node) *parse.ActionNode {
+	t.declare(name, node)
+	actionPipe := createAPipeNode(node)
+	actionPipe.Decl = append(actionPipe.Decl, createAVariableNode(name, node))
+	cmdNode := createACmdNode(node)
 	cmdNode.Args = []parse.Node{node}
 	actionPipe.Cmds = append(actionPipe.Cmds, cmdNode)
-	return &parse.ActionNode{
-		NodeType: parse.NodeAction,
-		Pipe:     actionPipe,
-	}
+	return t.createAnActionNode(actionPipe)
 }
 
 // createAVariableAssignmentOfFieldNode creates a new ActionNode as an assignment
@@ -886,8 +1093,8 @@ func createAVariableAssignmentOfSomeNode(name string, node parse.Node) *parse.Ac
 // example:
 // {{ .Field.Node }}
 // this func will create: {{$name := .Field.Node }}
-func createAVariableAssignmentOfFieldNode(name string, f *parse.FieldNode) *parse.ActionNode {
-	return createAVariableAssignmentOfSomeNode(name, f)
+func (t *treeSimplifier) createAVariableAssignmentOfFieldNode(name string, f *parse.FieldNode) *parse.ActionNode {
+	return t.createAVariableAssignmentOfSomeNode(name, f)
 }
 
 // createAVariableAssignmentOfDotNode creates a new ActionNode as an assignment
@@ -895,8 +1102,8 @@ func createAVariableAssignmentOfFieldNode(name string, f *parse.FieldNode) *pars
 // example:
 // {{ . }}
 // this func will create: {{$name := . }}
-func createAVariableAssignmentOfDotNode(name string, f *parse.DotNode) *parse.ActionNode {
-	return createAVariableAssignmentOfSomeNode(name, f)
+func (t *treeSimplifier) createAVariableAssignmentOfDotNode(name string, f *parse.DotNode) *parse.ActionNode {
+	return t.createAVariableAssignmentOfSomeNode(name, f)
 }
 
 // createAVariableAssignmentOfVariableNode creates a new ActionNode as an assignment
@@ -904,55 +1111,72 @@ func createAVariableAssignmentOfDotNode(name string, f *parse.DotNode) *parse.Ac
 // example:
 // {{ $x }}
 // this func will create: {{$name := $x }}
-func createAVariableAssignmentOfVariableNode(name string, f *parse.VariableNode) *parse.ActionNode {
-	return createAVariableAssignmentOfSomeNode(name, f)
+func (t *treeSimplifier) createAVariableAssignmentOfVariableNode(name string, f *parse.VariableNode) *parse.ActionNode {
+	return t.createAVariableAssignmentOfSomeNode(name, f)
 }
 
-// createActionNodeToPrintVar creates a new ActionNode to print a var
+// createActionNodeToPrintVar creates a new ActionNode to print a var,
+// positioned at the action which declares it.
 // {{$name}}
-func createActionNodeToPrintVar(varname string) *parse.ActionNode {
-	newAction := &parse.ActionNode{}
-	newAction.NodeType = parse.NodeAction
-	newAction.Pipe = &parse.PipeNode{}
-	newAction.Pipe.NodeType = parse.NodePipe
-	newAction.Pipe.Decl = make([]*parse.VariableNode, 0)
-	newAction.Pipe.Cmds = make([]*parse.CommandNode, 0)
-	cmd := createACmdNode()
-	cmd.Args = append(cmd.Args, &parse.VariableNode{
-		NodeType: parse.NodeVariable,
-		Ident:    []string{varname},
-	})
-	newAction.Pipe.Cmds = append(newAction.Pipe.Cmds, cmd)
-	return newAction
+func (t *treeSimplifier) createActionNodeToPrintVar(varname string, origin *parse.ActionNode) *parse.ActionNode {
+	pipe := createAPipeNode(origin.Pipe)
+	pipe.Decl = make([]*parse.VariableNode, 0)
+	pipe.Cmds = make([]*parse.CommandNode, 0)
+	cmd := createACmdNode(origin.Pipe)
+	cmd.Args = append(cmd.Args, createAVariableNode(varname, origin.Pipe))
+	pipe.Cmds = append(pipe.Cmds, cmd)
+	return t.createAnActionNode(pipe)
+}
+
+// createAPipeNode creates an empty PipeNode positioned at the origin node.
+// When origin is a PipeNode, it is copied so that it belongs to the same tree.
+func createAPipeNode(origin parse.Node) *parse.PipeNode {
+	pipe := &parse.PipeNode{}
+	if p, ok := origin.(*parse.PipeNode); ok {
+		*pipe = *p
+	}
+	pipe.NodeType = parse.NodePipe
+	pipe.Pos = origin.Position()
+	pipe.IsAssign = false
+	pipe.Decl = nil
+	pipe.Cmds = nil
+	return pipe
 }
 
-// createAVariableNode creates a VariableNode with given name.
-func createAVariableNode(name string) *parse.VariableNode {
-	varNode := &parse.VariableNode{
-		NodeType: parse.NodeVariable,
-		Ident:    []string{name},
+// createAVariableNode creates a VariableNode with given name, positioned at the origin node.
+// When origin is a VariableNode, it is copied so that it belongs to the same tree.
+func createAVariableNode(name string, origin parse.Node) *parse.VariableNode {
+	varNode := &parse.VariableNode{}
+	if v, ok := origin.(*parse.VariableNode); ok {
+		*varNode = *v
 	}
+	varNode.NodeType = parse.NodeVariable
+	varNode.Pos = origin.Position()
+	varNode.Ident = []string{name}
 	return varNode
 }
 
-// createACmdNode creates an empty CommandNode.
-func createACmdNode() *parse.CommandNode {
+// createACmdNode creates an empty CommandNode, positioned at the origin node.
+// When origin is a CommandNode, it is copied so that it belongs to the same tree.
+func createACmdNode(origin parse.Node) *parse.CommandNode {
 	cmd := &parse.CommandNode{}
+	if c, ok := origin.(*parse.CommandNode); ok {
+		*cmd = *c
+	}
 	cmd.NodeType = parse.NodeCommand
+	cmd.Pos = origin.Position()
+	cmd.Args = nil
 	return cmd
 }
 
 // replaceCmdWithVar replaces given searched command,
 // with the provided varnode within pipe.Cmds.
-// It creates a new command to embed the varnode before it is inserted.
+// It creates a new command, positioned at search, to embed the varnode before it is inserted.
 // it returns false it search node was not found.
 func replaceCmdWithVar(pipe *parse.PipeNode, search *parse.CommandNode, varnode *parse.VariableNode) bool {
 	for i := 0; i < len(pipe.Cmds); i++ {
 		if pipe.Cmds[i] == search {
-			newCmd := &parse.CommandNode{
-				NodeType: parse.NodeCommand,
-				Args:     make([]parse.Node, 0),
-			}
+			newCmd := createACmdNode(search)
 			newCmd.Args = append(newCmd.Args, varnode)
 			pipe.Cmds[i] = newCmd
 			return true
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"testing"
 	"text/template"
+	"text/template/parse"
 
 	"github.com/mh-cbon/template-tree-simplifier/simplifier"
 )
@@ -525,6 +526,69 @@ func TestAll(t *testing.T) {
 			data:         tplData{},
 			simplify:     true,
 		},
+		TestData{
+			tplstr:       `{{if eq .Some nil}}{{end}}`,
+			expectTplStr: `{{$var1 := .Some}}{{$var0 := eq $var1 nil}}{{if $var0}}{{end}}`,
+			funcs:        defFuncs,
+			data:         type5{},
+			simplify:     true,
+		},
+		TestData{
+			tplstr:       `{{(index .Some 0).Some}}`,
+			expectTplStr: `{{$var1 := .Some}}{{$var0 := index $var1 0}}{{$var2 := $var0.Some}}{{$var2}}`,
+			funcs:        defFuncs,
+			data:         type6{Some: []type1{type1{Some: []string{"a"}}}},
+			simplify:     true,
+		},
+		TestData{
+			tplstr:       `{{up (index (index .Some 0).Some 0)}}`,
+			expectTplStr: `{{$var2 := .Some}}{{$var1 := index $var2 0}}{{$var3 := $var1.Some}}{{$var0 := index $var3 0}}{{$var4 := up $var0}}{{$var4}}`,
+			funcs:        defFuncs,
+			data:         type6{Some: []type1{type1{Some: []string{"a"}}}},
+			simplify:     true,
+		},
+		TestData{
+			tplstr:       `{{$x := "a"}}{{if true}}{{$x = up .Some}}{{end}}{{$x}}`,
+			expectTplStr: `{{$tplX := "a"}}{{if true}}{{$var0 := .Some}}{{$tplX = up $var0}}{{end}}{{$tplX}}`,
+			funcs:        defFuncs,
+			data:         type2{Some: "b"},
+			simplify:     true,
+		},
+		TestData{
+			tplstr:       `{{range .}}{{if eq . "b"}}{{break}}{{end}}{{up .}}{{end}}`,
+			expectTplStr: `{{$var0 := .}}{{range $var0}}{{$var1 := eq . "b"}}{{if $var1}}{{break}}{{end}}{{$var2 := up .}}{{$var2}}{{end}}`,
+			funcs:        defFuncs,
+			data:         []string{"a", "b", "c"},
+			simplify:     true,
+		},
+		TestData{
+			tplstr:       `{{range $i, $v := .}}{{if eq $v "b"}}{{continue}}{{end}}{{lower $v | up}}{{end}}`,
+			expectTplStr: `{{$var0 := .}}{{range $tplI, $tplV := $var0}}{{$var1 := eq $tplV "b"}}{{if $var1}}{{continue}}{{end}}{{$var3 := lower $tplV}}{{$var2 := up $var3}}{{$var2}}{{end}}`,
+			funcs:        defFuncs,
+			data:         []string{"a", "b", "c"},
+			simplify:     true,
+		},
+		TestData{
+			tplstr:       `{{if not .Some}}none{{else if eq (lower .Some.Some.Some) "x"}}x{{else if .Some.Some.Some}}{{.Some.Some.Some}}{{end}}`,
+			expectTplStr: `{{$var1 := .Some}}{{$var0 := not $var1}}{{if $var0}}none{{else}}{{$var4 := .Some.Some.Some}}{{$var3 := lower $var4}}{{$var2 := eq $var3 "x"}}{{if $var2}}x{{else}}{{$var5 := .Some.Some.Some}}{{if $var5}}{{$var6 := .Some.Some.Some}}{{$var6}}{{end}}{{end}}{{end}}`,
+			funcs:        defFuncs,
+			data:         type5{},
+			simplify:     true,
+		},
+		TestData{
+			tplstr:       `{{with .Some}}{{.Some.Some}}{{else with .Some}}{{.Some.Some}}{{else}}none{{end}}`,
+			expectTplStr: `{{$var0 := .Some}}{{with $var0}}{{$var1 := .Some.Some}}{{$var1}}{{else}}{{$var2 := .Some}}{{with $var2}}{{$var3 := .Some.Some}}{{$var3}}{{else}}none{{end}}{{end}}`,
+			funcs:        defFuncs,
+			data:         type5{},
+			simplify:     true,
+		},
+		TestData{
+			tplstr:       `{{$x := .Some}}{{if not $x}}none{{else if $x.Some}}{{up $x.Some.Some}}{{end}}`,
+			expectTplStr: `{{$tplX := .Some}}{{$var0 := not $tplX}}{{if $var0}}none{{else}}{{if $tplX.Some}}{{$var1 := $tplX.Some.Some}}{{$var2 := up $var1}}{{$var2}}{{end}}{{end}}`,
+			funcs:        defFuncs,
+			data:         type5{Some: &type3{Some: type2{Some: "x"}}},
+			simplify:     true,
+		},
 	}
 
 	for i, testData := range testTable {
@@ -534,6 +598,26 @@ func TestAll(t *testing.T) {
 	}
 }
 
+func TestElseIf(t *testing.T) {
+	// an {{else if}} whose condition is not modified keeps its shape,
+	// the else list contains the nested IfNode only.
+	tpl := template.Must(template.New("").Funcs(template.FuncMap{"up": strings.ToUpper}).Parse(
+		`{{$x := .Some}}{{if not $x}}none{{else if $x.Some}}{{up $x.Some.Some}}{{end}}`))
+	simplifier.Simplify(tpl.Tree)
+	var ifNode *parse.IfNode
+	for _, node := range tpl.Tree.Root.Nodes {
+		if n, ok := node.(*parse.IfNode); ok {
+			ifNode = n
+		}
+	}
+	if ifNode == nil || ifNode.ElseList == nil || len(ifNode.ElseList.Nodes) != 1 {
+		t.Fatalf("expected the else list to contain a single node\n%v", tpl.Tree.Root)
+	}
+	if _, ok := ifNode.ElseList.Nodes[0].(*parse.IfNode); !ok {
+		t.Errorf("expected the else list to contain an IfNode, got %T", ifNode.ElseList.Nodes[0])
+	}
+}
+
 func execTestData(testData TestData, t *testing.T, index int) bool {
 	// ensure the template is valid and working
 	tpl, err := template.New("").Funcs(testData.funcs).Parse(testData.tplstr)
@@ -660,5 +744,6 @@ func simplifytemplate(t *template.Template) *template.Template {
 
 func exectemplate(t *template.Template, data interface{}) (string, error) {
 	var b bytes.Buffer
-	return b.String(), t.Execute(&b, data)
+	err := t.Execute(&b, data)
+	return b.String(), err
 }
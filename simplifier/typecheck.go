@@ -3,47 +3,174 @@ package simplifier
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"text/template/parse"
 )
 
-// TypeCheck browses the tree to identify variable types.
+// TypeCheck browses the tree to identify variable types,
+// and the types of the expression nodes, see State.TypeOf.
+// The tree does not need to be simplified, it is not modified.
 func TypeCheck(tree *parse.Tree, data interface{}, funcs map[string]interface{}) *State {
+	s, _ := typeCheck(tree, data, funcs, false)
+	return s
+}
+
+// TypeCheckAll is like TypeCheck, but it does not stop at the first problem.
+// It returns every problem found along with the partially typed State,
+// the variables which could not be typed are registered with a nil type.
+func TypeCheckAll(tree *parse.Tree, data interface{}, funcs map[string]interface{}) (*State, []*Diagnostic) {
+	return typeCheck(tree, data, funcs, true)
+}
+
+// typeCheck browses the tree to identify variable types,
+// when collect is true, problems are collected rather than raised.
+func typeCheck(tree *parse.Tree, data interface{}, funcs map[string]interface{}, collect bool) (*State, []*Diagnostic) {
+	return typeCheckDot(tree, reflect.TypeOf(data), funcs, collect)
+}
+
+// typeCheckDot is typeCheck with the type of the root dot.
+func typeCheckDot(tree *parse.Tree, dot reflect.Type, funcs map[string]interface{}, collect bool) (*State, []*Diagnostic) {
 	s := &State{
 		currentScope: -1,
 		vars:         []map[string]reflect.Type{},
 	}
 	t := &treeTypecheck{
-		funcs: funcs,
-		tree:  tree,
+		funcs:   funcs,
+		tree:    tree,
+		collect: collect,
 	}
 	s.Add()
 	s.Enter()
-	s.AddVar(".", reflect.TypeOf(data))
+	s.AddVar(".", dot)
 	t.process(tree, s)
 	s.Leave()
-	return s
+	return s, t.diagnostics
+}
+
+// TypeCheckE is like TypeCheck,
+// but it returns an error rather than panicking.
+func TypeCheckE(tree *parse.Tree, data interface{}, funcs map[string]interface{}) (state *State, err error) {
+	defer recoverError(&err)
+	return TypeCheck(tree, data, funcs), nil
 }
 
-// treeTypecheck ...
+// treeTypecheck holds,
+// the tree to check,
+// the funcs available to the template,
+// collect to keep going after a problem, and the problems collected.
 type treeTypecheck struct {
-	tree  *parse.Tree
-	funcs map[string]interface{}
+	tree        *parse.Tree
+	funcs       map[string]interface{}
+	collect     bool
+	diagnostics []*Diagnostic
+}
+
+// untypedNil is the type of the nil keyword.
+type untypedNil struct{}
+
+// NilType is the type of an untyped nil, such as in {{eq .Some nil}}.
+// It is assignable to pointers, interfaces, maps, slices, channels and funcs,
+// see IsNilAssignable.
+var NilType = reflect.TypeOf(untypedNil{})
+
+// typeString returns the name of the type r in the messages,
+// NilType is named nil, as text/template does.
+func typeString(r reflect.Type) string {
+	if r == NilType {
+		return "nil"
+	}
+	return fmt.Sprint(r)
+}
+
+// IsNilAssignable tells if an untyped nil can be assigned to a value of type r.
+func IsNilAssignable(r reflect.Type) bool {
+	if r == nil {
+		return false
+	}
+	switch r.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		return true
+	}
+	return r == NilType
+}
+
+// TemplateCall is a call to a template, {{template "name" pipeline}}.
+type TemplateCall struct {
+	Name string              // the called template
+	Node *parse.TemplateNode // the call site
+	Dot  reflect.Type        // the type of the dot passed to the template, nil when it is unknown
 }
 
 // State ...
 type State struct {
 	currentScope int
+	nextScope    int
 	vars         []map[string]reflect.Type
+	addressables []map[string]bool
+	parents      []int
+	calls        []TemplateCall
+	types        map[parse.Node]reflect.Type
+	failing      map[parse.Node]bool
+	sourceMap    *SourceMap
+}
+
+// TypeOf returns the type of an expression node of the tree,
+// such as a field, a variable, a command or a pipe.
+// It returns nil when the type is unknown, or when the node is not an expression.
+func (s *State) TypeOf(node parse.Node) reflect.Type {
+	return s.types[node]
+}
+
+// setType records the type of an expression node.
+func (s *State) setType(node parse.Node, r reflect.Type) {
+	if s.types == nil {
+		s.types = map[parse.Node]reflect.Type{}
+	}
+	s.types[node] = r
+}
+
+// CanFail tells if the function, or the method, call at node can fail at runtime,
+// it returns a value and an error, such as func(string) (string, error), or index.
+// node is the command of the call, or the identifier, the field, the variable or the chain
+// of a call used as an argument.
+func (s *State) CanFail(node parse.Node) bool {
+	return s.failing[node]
 }
 
-// Add a new scope level.
+// setCanFail records that the function call at node can fail.
+func (s *State) setCanFail(node parse.Node) {
+	if s.failing == nil {
+		s.failing = map[parse.Node]bool{}
+	}
+	s.failing[node] = true
+}
+
+// Calls returns the calls to templates found in the tree,
+// in their order of appearance.
+func (s *State) Calls() []TemplateCall {
+	return s.calls
+}
+
+// SourceMap returns the map of the transformed tree
+// back to the original template source,
+// it is nil when the State was not produced by TransformTree.
+func (s *State) SourceMap() *SourceMap {
+	return s.sourceMap
+}
+
+// Add a new scope level, nested into the current one.
+// The scopes are added in the order of the template,
+// a body and its else branch are two sibling scopes.
 func (s *State) Add() {
 	s.vars = append(s.vars, map[string]reflect.Type{})
+	s.addressables = append(s.addressables, map[string]bool{})
+	s.parents = append(s.parents, s.currentScope)
 }
 
-// Enter into a scope level.
+// Enter into the next scope level, in the order they were added.
 func (s *State) Enter() {
-	s.currentScope++
+	s.currentScope = s.nextScope
+	s.nextScope++
 }
 
 // Len returns the number of scopes.
@@ -56,9 +183,13 @@ func (s *State) Level() int {
 	return s.currentScope
 }
 
-// Leave a scope level.
+// Leave a scope level, back to its parent,
+// leaving the root scope rewinds the state, its scopes can be entered again.
 func (s *State) Leave() {
-	s.currentScope--
+	s.currentScope = s.parents[s.currentScope]
+	if s.currentScope < 0 {
+		s.nextScope = 0
+	}
 }
 
 // Current scope vars.
@@ -84,6 +215,24 @@ func (s *State) RootDot() reflect.Type {
 // AddVar in the current scope level.
 func (s *State) AddVar(name string, r reflect.Type) {
 	s.Current()[name] = r
+	delete(s.addressables[s.currentScope], name)
+}
+
+// setAddressable records that the variable name of the current scope holds an addressable value,
+// such as the dot of a range over a slice, or a field reached through a pointer.
+func (s *State) setAddressable(name string) {
+	s.addressables[s.currentScope][name] = true
+}
+
+// isAddressable tells if the variable name, looked up from the current scope to the root,
+// holds an addressable value, the root dot is not addressable.
+func (s *State) isAddressable(name string) bool {
+	for i := s.currentScope; i >= 0; i = s.parents[i] {
+		if _, ok := s.vars[i][name]; ok {
+			return s.addressables[i][name]
+		}
+	}
+	return false
 }
 
 // HasVar tells if current level contains given variable name.
@@ -100,84 +249,253 @@ func (s *State) GetVar(name string) reflect.Type {
 
 // FindVar starting from current scope level to the root.
 func (s *State) FindVar(name string) reflect.Type {
-	for i := s.currentScope; i >= 0; i-- {
+	r, _ := s.lookupVar(name)
+	return r
+}
+
+// lookupVar is FindVar, it also tells if the variable was found.
+// A variable which could not be typed is found with a nil type.
+func (s *State) lookupVar(name string) (reflect.Type, bool) {
+	for i := s.currentScope; i >= 0; i = s.parents[i] {
 		if v, ok := s.vars[i][name]; ok {
-			return v
+			return v, true
 		}
 	}
 	if name == "$" {
-		return s.RootDot()
+		return s.RootDot(), true
 	}
-	return nil
+	return nil, false
 }
 
-// BrowsePathType ...
+// BrowsePathType returns the type of the value found at the end of path,
+// the methods of the path are called without arguments, as text/template does.
+// val is not addressable, as the data given to a template, the methods of *T are found through pointers.
+// It panics if the path does not exist, or if a method of the path can not be called so.
 func (s *State) BrowsePathType(path []string, val reflect.Type) reflect.Type {
+	r, _, _, err := s.browsePathType(path, val, false)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// browsePathType is BrowsePathType returning an error,
+// the path starts from a value of type val, addressable tells if it is addressable,
+// such as the dot of a range over a slice.
+// It returns whether the value found is addressable,
+// canFail tells if a method of the path returns an error.
+func (s *State) browsePathType(path []string, val reflect.Type, addressable bool) (reflect.Type, bool, bool, error) {
+	canFail := false
 	for _, p := range path {
 		if val.Kind() == reflect.Interface {
-			return val
+			return val, false, canFail, nil
 		}
-		if val.Kind() == reflect.Ptr {
-			val = val.Elem()
+		val, addressable = indirectType(val, addressable)
+		field, meth, fieldAddressable, err := pathElem("State.BrowsePathType", val, p, addressable)
+		if err != nil {
+			return nil, false, false, err
 		}
-		field, found := val.FieldByName(p)
-		if !found {
-			meth, found := val.MethodByName(p)
-			if !found {
-				err := fmt.Errorf("State.BrowsePathType: path %v not found in type %v", path, val)
-				panic(err)
+		if field != nil {
+			val, addressable = field, fieldAddressable
+			continue
+		}
+		if meth == nil {
+			return nil, false, false, &PathNotFoundError{Op: "State.BrowsePathType", Path: path, Type: val}
+		}
+		if !isGoodFunc(meth) {
+			return nil, false, false, &FuncResultError{Op: "State.BrowsePathType", Name: p, Type: meth}
+		}
+		if meth.NumIn() > 1 || meth.NumIn() == 1 && !meth.IsVariadic() {
+			return nil, false, false, &FuncArgCountError{Op: "State.BrowsePathType", Name: p, Want: meth.NumIn(), Got: 0, Variadic: meth.IsVariadic()}
+		}
+		canFail = canFail || meth.NumOut() == 2
+		val, addressable = meth.Out(0), false
+	}
+	return val, addressable, canFail, nil
+}
+
+// indirectType dereferences the pointer type val,
+// the value pointed to is addressable.
+func indirectType(val reflect.Type, addressable bool) (reflect.Type, bool) {
+	for val.Kind() == reflect.Ptr {
+		val, addressable = val.Elem(), true
+	}
+	return val, addressable
+}
+
+// pathElem resolves the element name of a path on a value of type val, which is not a pointer,
+// the way text/template evaluates a field:
+// the methods are looked up first, the ones of *T too when the value is addressable,
+// then the fields of a struct, through its embedded structs and pointers, and the keys of a map.
+// It returns the type of the field, or of the map element, and whether it is addressable,
+// or the type of the method, without its receiver.
+// Both types are nil when the element is not found.
+// An unexported field is an error, text/template can not read it,
+// the unexported methods are not visible, they are not found.
+func pathElem(op string, val reflect.Type, name string, addressable bool) (field reflect.Type, method reflect.Type, fieldAddressable bool, err error) {
+	if meth, found := methodType(val, name, addressable); found {
+		return nil, meth, false, nil
+	}
+	if val.Kind() == reflect.Struct {
+		if f, found := val.FieldByName(name); found {
+			if !f.IsExported() {
+				return nil, nil, false, &UnexportedFieldError{Op: op, Name: name, Type: val}
 			}
-			val = meth.Type.Out(0)
-		} else {
-			val = field.Type
+			return f.Type, nil, addressable || isEmbeddedPtr(val, f.Index), nil
 		}
 	}
-	return val
+	if isMapKey(val, name) {
+		return val.Elem(), nil, false, nil
+	}
+	return nil, nil, false, nil
+}
+
+// isEmbeddedPtr tells if the field at index of the struct val is reached through an embedded pointer,
+// the field is then addressable.
+func isEmbeddedPtr(val reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		f := val.Field(i)
+		if f.Type.Kind() == reflect.Ptr {
+			return true
+		}
+		val = f.Type
+	}
+	return false
+}
+
+// isMapKey tells if val is a map whose keys can be the name of a field path,
+// such as map[string]T, {{.Config.db}} is the value of the key db of the map .Config.
+func isMapKey(val reflect.Type, name string) bool {
+	return val.Kind() == reflect.Map && reflect.TypeOf(name).AssignableTo(val.Key())
+}
+
+// methodType returns the type of the method name of val, without its receiver.
+// The methods of *T are found on an addressable T, as text/template does.
+func methodType(val reflect.Type, name string, addressable bool) (reflect.Type, bool) {
+	meth, found := val.MethodByName(name)
+	if !found && addressable && val.Kind() != reflect.Interface && val.Kind() != reflect.Ptr {
+		meth, found = reflect.PtrTo(val).MethodByName(name)
+	}
+	if !found {
+		return nil, false
+	}
+	if val.Kind() == reflect.Interface {
+		// the methods of an interface have no receiver.
+		return meth.Type, true
+	}
+	in := []reflect.Type{}
+	for i := 1; i < meth.Type.NumIn(); i++ {
+		in = append(in, meth.Type.In(i))
+	}
+	out := []reflect.Type{}
+	for i := 0; i < meth.Type.NumOut(); i++ {
+		out = append(out, meth.Type.Out(i))
+	}
+	return reflect.FuncOf(in, out, meth.Type.IsVariadic()), true
 }
 
-// IsMethodPath ...
+// IsMethodPath tells if path leads to a method, through fields and map keys,
+// val is not addressable, see BrowsePathType.
 func (s *State) IsMethodPath(path []string, val reflect.Type) bool {
+	addressable := false
 	for _, p := range path {
 		if val.Kind() == reflect.Interface {
 			return false
 		}
-		if val.Kind() == reflect.Ptr {
-			val = val.Elem()
+		val, addressable = indirectType(val, addressable)
+		field, meth, fieldAddressable, _ := pathElem("State.IsMethodPath", val, p, addressable)
+		if meth != nil {
+			return true
 		}
-		if val.Kind() == reflect.Struct {
-			field, found := val.FieldByName(p)
-			if !found {
-				_, found := val.MethodByName(p)
-				return found
-			}
-			val = field.Type
+		if field == nil {
+			return false
 		}
+		val, addressable = field, fieldAddressable
 	}
 	return false
 }
 
-// ReflectPath ...
+// ReflectPath returns the type found at the end of path, made of fields and map keys,
+// or the type of the first method met along the path, without its receiver.
+// It returns nil when the path does not exist, or when it reads an unexported field.
+// val is not addressable, see BrowsePathType.
 func (s *State) ReflectPath(path []string, val reflect.Type) reflect.Type {
+	addressable := false
 	for _, p := range path {
 		if val.Kind() == reflect.Interface {
 			return val
 		}
-		if val.Kind() == reflect.Ptr {
-			val = val.Elem()
+		val, addressable = indirectType(val, addressable)
+		field, meth, fieldAddressable, _ := pathElem("State.ReflectPath", val, p, addressable)
+		if meth != nil {
+			return meth
 		}
-		field, found := val.FieldByName(p)
-		if !found {
-			meth, found := val.MethodByName(p)
-			if found {
-				return meth.Type
-			}
+		if field == nil {
 			return nil
 		}
-		val = field.Type
+		val, addressable = field, fieldAddressable
 	}
 	return val
 }
 
+// error reports err located at node,
+// it stops the processing unless problems are collected.
+func (t *treeTypecheck) error(node parse.Node, err error) {
+	d := newDiagnostic(t.tree, node, SeverityError, err)
+	if !t.collect {
+		panic(d)
+	}
+	t.diagnostics = append(t.diagnostics, d)
+}
+
+// browsePathType is State.BrowsePathType reporting failures at node,
+// the path starts from a value of type val, addressable tells if it is addressable.
+// When args or final are given, the last element of the path is a method,
+// it is called with the arguments args, and the result of the command final.
+// A path browsed on an unknown type has an unknown type.
+func (t *treeTypecheck) browsePathType(node parse.Node, state *State, path []string, val reflect.Type, addressable bool, args []parse.Node, final *parse.CommandNode) reflect.Type {
+	if val == nil {
+		return nil
+	}
+	called := len(args) > 0 || final != nil
+	browsed := path
+	if called {
+		browsed = path[:len(path)-1]
+	}
+	r, addressable, canFail, err := state.browsePathType(browsed, val, addressable)
+	if err != nil {
+		t.error(node, err)
+		return nil
+	}
+	if canFail {
+		state.setCanFail(node)
+	}
+	if !called || r.Kind() == reflect.Interface {
+		return r
+	}
+	name := path[len(path)-1]
+	r, addressable = indirectType(r, addressable)
+	field, meth, _, err := pathElem("treeTypecheck.browsePathType", r, name, addressable)
+	if err != nil {
+		t.error(node, err)
+		return nil
+	}
+	if field != nil {
+		err := &NotAFunctionError{Op: "treeTypecheck.browsePathType", Name: name}
+		t.error(node, err)
+		return nil
+	}
+	if meth == nil {
+		err := &PathNotFoundError{Op: "State.BrowsePathType", Path: path, Type: r}
+		t.error(node, err)
+		return nil
+	}
+	if !t.checkCall(node, name, meth, args, final, state) {
+		return nil
+	}
+	return meth.Out(0)
+}
+
 // process the tree until no more simplification can be done.
 func (t *treeTypecheck) process(tree *parse.Tree, state *State) {
 	t.browseNodes(tree.Root, state)
@@ -202,22 +520,25 @@ func (t *treeTypecheck) browseNodes(l interface{}, state *State) {
 		t.enterRangeNode(node, state)
 		t.browseNodes(node.Pipe, state)
 		t.browseNodes(node.List, state)
-		t.browseNodes(node.ElseList, state)
 		state.Leave()
+		t.browseElseList(node.ElseList, node.Pipe, state)
 
 	case *parse.IfNode:
+		t.enterIfNode(node, state)
 		t.browseNodes(node.Pipe, state)
 		t.browseNodes(node.List, state)
-		t.browseNodes(node.ElseList, state)
+		state.Leave()
+		t.browseElseList(node.ElseList, node.Pipe, state)
 
 	case *parse.WithNode:
 		t.enterWithNode(node, state)
 		t.browseNodes(node.Pipe, state)
 		t.browseNodes(node.List, state)
-		t.browseNodes(node.ElseList, state)
 		state.Leave()
+		t.browseElseList(node.ElseList, node.Pipe, state)
 
 	case *parse.TemplateNode:
+		t.typeCheckTemplateNode(node, state)
 		if node.Pipe != nil {
 			t.browseNodes(node.Pipe, state)
 		}
@@ -235,6 +556,9 @@ func (t *treeTypecheck) browseNodes(l interface{}, state *State) {
 			t.browseNodes(c, state)
 		}
 
+	case *parse.ChainNode:
+		t.browseNodes(node.Node, state)
+
 	case *parse.VariableNode:
 		//pass
 	case *parse.IdentifierNode:
@@ -245,16 +569,25 @@ func (t *treeTypecheck) browseNodes(l interface{}, state *State) {
 		//pass
 	case *parse.BoolNode:
 		//pass
+	case *parse.NilNode:
+		//pass
+	case *parse.BreakNode:
+		//pass
+	case *parse.ContinueNode:
+		//pass
 	case *parse.DotNode:
 		//pass
 	case *parse.FieldNode:
 		//pass
 	case *parse.TextNode:
 		//pass
+	case *parse.CommentNode:
+		//pass
 
 	default:
-		err := fmt.Errorf("treeTypecheck.browseNodes: unhandled node type\n%v\n%#v", node, node)
-		panic(err)
+		n, _ := node.(parse.Node)
+		err := &UnhandledNodeError{Op: "treeTypecheck.browseNodes", Node: n}
+		t.error(n, err)
 	}
 }
 
@@ -269,139 +602,592 @@ func (t *treeTypecheck) typeCheckActionNode(node *parse.ActionNode, state *State
 		{{$some := "what"}}
 		{{$some := 4}}
 		{{$some := true}}
+		{{$some := (index .Users 0).Name}}
+		{{$some := .Field | up}}
 	*/
 	if len(node.Pipe.Decl) > 0 && len(node.Pipe.Decl[0].Ident) == 1 {
-		varName := node.Pipe.Decl[0].Ident[0]
-		if len(node.Pipe.Cmds) == 1 && len(node.Pipe.Cmds[0].Args) > 0 {
-			if field, ok := node.Pipe.Cmds[0].Args[0].(*parse.FieldNode); ok {
-				r := state.BrowsePathType(field.Ident, state.Dot())
-				state.AddVar(varName, r)
-
-			} else if variable, ok := node.Pipe.Cmds[0].Args[0].(*parse.VariableNode); ok {
-				rightVarType := state.FindVar(variable.Ident[0])
-				if rightVarType == nil {
-					panic(fmt.Errorf("%v\nVariable not found %v in %v", t.tree.Root.String(), variable.Ident[0], node))
-				}
-				if len(variable.Ident) > 1 {
-					rightVarType = state.BrowsePathType(variable.Ident[1:], rightVarType)
-				}
-				state.AddVar(varName, rightVarType)
-
-			} else if _, ok := node.Pipe.Cmds[0].Args[0].(*parse.DotNode); ok {
-				rightVarType := state.Dot()
-				state.AddVar(varName, rightVarType)
-
-			} else if ident, ok := node.Pipe.Cmds[0].Args[0].(*parse.IdentifierNode); ok {
-				funcRetType := t.getFuncValueType(ident.Ident)
-				state.AddVar(varName, funcRetType)
-
-			} else if _, ok := node.Pipe.Cmds[0].Args[0].(*parse.StringNode); ok {
-				state.AddVar(varName, reflect.TypeOf(""))
-
-			} else if _, ok := node.Pipe.Cmds[0].Args[0].(*parse.NumberNode); ok {
-				state.AddVar(varName, reflect.TypeOf(0))
-
-			} else if _, ok := node.Pipe.Cmds[0].Args[0].(*parse.BoolNode); ok {
-				state.AddVar(varName, reflect.TypeOf(true))
-
-			}
+		var varType reflect.Type
+		if len(node.Pipe.Cmds) > 0 && len(node.Pipe.Cmds[0].Args) > 0 {
+			varType = t.pipeType(node.Pipe, state)
 		} else {
-			err := fmt.Errorf("treeTypecheck.typeCheckActionNode: unhandled length of node.Pipe.Decl or node.Pipe.Cmds\n%v\n%#v", node, node)
-			panic(err)
+			err := &UnhandledNodeError{Op: "treeTypecheck.typeCheckActionNode", Node: node, Reason: "unhandled length of node.Pipe.Cmds"}
+			t.error(node, err)
+		}
+		t.addVar(node.Pipe, node.Pipe.Decl[0], varType, state)
+		if !node.Pipe.IsAssign && t.isPipeAddressable(node.Pipe, state) {
+			state.setAddressable(node.Pipe.Decl[0].Ident[0])
 		}
+	} else {
+		t.pipeType(node.Pipe, state)
 	}
 	return false
 }
 
-func (t *treeTypecheck) enterRangeNode(node *parse.RangeNode, state *State) bool {
-	var newDotType reflect.Type
-	if len(node.Pipe.Cmds) == 1 {
-		if variable, ok := node.Pipe.Cmds[0].Args[0].(*parse.VariableNode); ok {
-			//-
-			rightVarType := state.FindVar(variable.Ident[0])
-			if len(variable.Ident) > 1 {
-				rightVarType = state.BrowsePathType(variable.Ident[1:], rightVarType)
-			}
-			newDotType = rightVarType
+// typeCheckTemplateNode records the call to a template,
+// with the type of the dot it is given.
+// {{template "name"}} executes the template with a nil dot.
+func (t *treeTypecheck) typeCheckTemplateNode(node *parse.TemplateNode, state *State) {
+	var dot reflect.Type
+	if node.Pipe != nil {
+		dot = t.pipeType(node.Pipe, state)
+	}
+	state.calls = append(state.calls, TemplateCall{Name: node.Name, Node: node, Dot: dot})
+}
+
+// addVar declares the variable of a pipe with the type r.
+// When the pipe is an assignment, {{$x = ...}},
+// the variable is not declared, r is checked against the type of the variable in scope.
+func (t *treeTypecheck) addVar(pipe *parse.PipeNode, variable *parse.VariableNode, r reflect.Type, state *State) {
+	name := variable.Ident[0]
+	if !pipe.IsAssign {
+		state.AddVar(name, r)
+		state.setType(variable, r)
+		return
+	}
+	declared, found := state.lookupVar(name)
+	state.setType(variable, declared)
+	if !found {
+		err := &VariableNotFoundError{Op: "treeTypecheck.addVar", Name: name, Node: variable}
+		t.error(variable, err)
+		return
+	}
+	if !isAssignable(r, declared) {
+		err := &IncompatibleAssignError{Op: "treeTypecheck.addVar", Name: name, Type: declared, Assigned: r}
+		t.error(variable, err)
+	}
+}
 
-		} else if _, ok := node.Pipe.Cmds[0].Args[0].(*parse.DotNode); ok {
-			newDotType = state.Dot()
+// isAssignable tells if a value of type r can be assigned to a variable of type to.
+// Unknown types, and interface values, which are resolved at runtime, are assignable.
+func isAssignable(r reflect.Type, to reflect.Type) bool {
+	if r == nil || to == nil {
+		return true
+	}
+	if r == NilType {
+		return IsNilAssignable(to)
+	}
+	if r.Kind() == reflect.Interface {
+		return true
+	}
+	return r.AssignableTo(to)
+}
 
-		} else {
-			err := fmt.Errorf("treeTypecheck.enterRangeNode: unhandled type of Arg[0]\n%v\n%#v", node, node)
-			panic(err)
+// enterIfNode opens the scope of the body of an if, it keeps the dot,
+// the variable declared by the pipeline is scoped to the if.
+func (t *treeTypecheck) enterIfNode(node *parse.IfNode, state *State) bool {
+	pipeType := t.pipeType(node.Pipe, state)
+	pipeAddressable := t.isPipeAddressable(node.Pipe, state)
+	dot, dotAddressable := state.Dot(), state.isAddressable(".")
+	state.Add()
+	state.Enter()
+	state.AddVar(".", dot)
+	if dotAddressable {
+		state.setAddressable(".")
+	}
+	t.addPipeVars(node, node.Pipe, pipeType, pipeAddressable, state)
+	return false
+}
+
+// browseElseList browses the else branch of an if, a range or a with, within its own scope.
+// The else branch has the dot of the enclosing scope, as in text/template,
+// it sees the variables declared by pipe, they hold the value of the pipeline,
+// the ones of a range included.
+func (t *treeTypecheck) browseElseList(list *parse.ListNode, pipe *parse.PipeNode, state *State) {
+	if list == nil {
+		return
+	}
+	pipeAddressable := t.isPipeAddressable(pipe, state)
+	dot, dotAddressable := state.Dot(), state.isAddressable(".")
+	state.Add()
+	state.Enter()
+	state.AddVar(".", dot)
+	if dotAddressable {
+		state.setAddressable(".")
+	}
+	if !pipe.IsAssign {
+		for _, decl := range pipe.Decl {
+			state.AddVar(decl.Ident[0], state.TypeOf(pipe))
+			if pipeAddressable {
+				state.setAddressable(decl.Ident[0])
+			}
 		}
-	} else {
-		err := fmt.Errorf("treeTypecheck.enterRangeNode: unhandled length of node.Pipe.Cmds\n%v\n%#v", node, node)
-		panic(err)
 	}
-	if newDotType == nil {
-		err := fmt.Errorf("treeTypecheck.enterRangeNode: new dot type not found\n%v\n%#v", node, node)
-		panic(err)
+	t.browseNodes(list, state)
+	state.Leave()
+}
+
+// addPipeVars adds the variable declared by the pipeline of an if or a with to the current scope,
+// it has the type r of the pipeline, addressable tells if the value of the pipeline is addressable.
+func (t *treeTypecheck) addPipeVars(node parse.Node, pipe *parse.PipeNode, r reflect.Type, addressable bool, state *State) {
+	if len(pipe.Decl) == 0 {
+		return
+	}
+	if len(pipe.Decl) > 1 {
+		err := &UnhandledNodeError{Op: "treeTypecheck.addPipeVars", Node: node, Reason: "unhandled length of node.Pipe.Decl"}
+		t.error(node, err)
+		return
+	}
+	t.addVar(pipe, pipe.Decl[0], r, state)
+	if !pipe.IsAssign && addressable {
+		state.setAddressable(pipe.Decl[0].Ident[0])
 	}
+}
+
+// isPipeAddressable tells if the value of a pipeline is addressable,
+// it is when the pipeline is a single addressable argument, see isArgAddressable.
+func (t *treeTypecheck) isPipeAddressable(pipe *parse.PipeNode, state *State) bool {
+	if len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	return t.isArgAddressable(pipe.Cmds[0].Args[0], state)
+}
+
+// isArgAddressable tells if the value of an argument node is addressable,
+// it is when the node is the dot, a variable or a field path, reaching an addressable value.
+// The results of the functions and of the methods are not addressable.
+func (t *treeTypecheck) isArgAddressable(node parse.Node, state *State) bool {
+	switch node := node.(type) {
+	case *parse.DotNode:
+		return state.isAddressable(".")
+	case *parse.VariableNode:
+		return isPathAddressable(node.Ident[1:], state.FindVar(node.Ident[0]), state.isAddressable(node.Ident[0]), state)
+	case *parse.FieldNode:
+		return isPathAddressable(node.Ident, state.Dot(), state.isAddressable("."), state)
+	}
+	return false
+}
+
+// isPathAddressable tells if the value found at path, from a value of type val, is addressable.
+func isPathAddressable(path []string, val reflect.Type, addressable bool, state *State) bool {
+	if val == nil {
+		return false
+	}
+	_, addressable, _, err := state.browsePathType(path, val, addressable)
+	return err == nil && addressable
+}
+
+func (t *treeTypecheck) enterRangeNode(node *parse.RangeNode, state *State) bool {
+	newDotType := t.pipeType(node.Pipe, state)
+	keyType, elemType, err := rangeTypes(newDotType, len(node.Pipe.Decl))
+	if err != nil {
+		t.error(node, err)
+	}
+	elemAddressable := isRangeElemAddressable(newDotType, t.isPipeAddressable(node.Pipe, state))
 	state.Add()
 	state.Enter()
-	state.AddVar(".", newDotType.Elem())
+	state.AddVar(".", elemType)
+	if elemAddressable {
+		state.setAddressable(".")
+	}
 	if len(node.Pipe.Decl) > 0 {
 		// add the new var to the new scope
-		if len(node.Pipe.Decl) == 1 {
-			state.AddVar(node.Pipe.Decl[0].Ident[0], state.Dot())
-
-		} else {
-			state.AddVar(node.Pipe.Decl[0].Ident[0], reflect.TypeOf(1))
-			state.AddVar(node.Pipe.Decl[1].Ident[0], state.Dot())
+		elemVar := node.Pipe.Decl[0]
+		if len(node.Pipe.Decl) > 1 {
+			t.addVar(node.Pipe, node.Pipe.Decl[0], keyType, state)
+			elemVar = node.Pipe.Decl[1]
+		}
+		t.addVar(node.Pipe, elemVar, state.Dot(), state)
+		if elemAddressable && !node.Pipe.IsAssign {
+			state.setAddressable(elemVar.Ident[0])
 		}
 	}
 	return false
 }
 
-func (t *treeTypecheck) enterWithNode(node *parse.WithNode, state *State) bool {
-	var newDotType reflect.Type
-	if len(node.Pipe.Cmds) == 1 {
-		if variable, ok := node.Pipe.Cmds[0].Args[0].(*parse.VariableNode); ok {
-			//-
-			rightVarType := state.FindVar(variable.Ident[0])
-			if len(variable.Ident) > 1 {
-				rightVarType = state.BrowsePathType(variable.Ident[1:], rightVarType)
-			}
-			newDotType = rightVarType
+// isRangeElemAddressable tells if the elements of a range over a value of type r are addressable,
+// addressable tells if the value ranged over is addressable.
+// The elements of a slice are, the ones of an array when it is, or when it is reached through a pointer,
+// the elements of a map, of a channel, and the integers are not.
+func isRangeElemAddressable(r reflect.Type, addressable bool) bool {
+	if r == nil {
+		return false
+	}
+	r, addressable = indirectType(r, addressable)
+	return r.Kind() == reflect.Slice || (r.Kind() == reflect.Array && addressable)
+}
+
+// rangeTypes returns the types of the key and of the element of a range over a value of type r,
+// declaring vars variables, the dot of the range is the element.
+// It follows the rules of a range clause,
+// - arrays and slices produce an int index and their elements,
+// - maps produce their keys and their elements,
+// - channels produce an int counter, as text/template does, and their elements,
+// - integers and iter.Seq produce a single element, an iter.Seq[T] produces T,
+// an integer produces an integer of the same type,
+// - iter.Seq2 produce their key and their element,
+// with a single variable, the key is used as the element.
+// Pointers are dereferenced, interface values are resolved at runtime, their types are unknown.
+func rangeTypes(r reflect.Type, vars int) (reflect.Type, reflect.Type, error) {
+	for r != nil && r.Kind() == reflect.Ptr {
+		r = r.Elem()
+	}
+	if r == nil || r.Kind() == reflect.Interface {
+		return nil, nil, nil
+	}
+	switch r.Kind() {
+	case reflect.Array, reflect.Slice:
+		return reflect.TypeOf(0), r.Elem(), nil
 
-		} else if _, ok := node.Pipe.Cmds[0].Args[0].(*parse.DotNode); ok {
-			newDotType = state.Dot()
+	case reflect.Map:
+		return r.Key(), r.Elem(), nil
 
-		} else {
-			err := fmt.Errorf("treeTypecheck.enterWithNode: unhandled type of Arg[0]\n%v\n%#v", node, node)
-			panic(err)
+	case reflect.Chan:
+		if r.ChanDir() == reflect.SendDir {
+			return nil, nil, &RangeTypeError{Op: "rangeTypes", Type: r, Reason: "cannot range over send-only channel"}
+		}
+		return reflect.TypeOf(0), r.Elem(), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if vars > 1 {
+			return nil, nil, &RangeTypeError{Op: "rangeTypes", Type: r, Reason: "too many variables in range over"}
+		}
+		return nil, r, nil
+
+	case reflect.Func:
+		if r.CanSeq() {
+			if vars > 1 {
+				return nil, nil, &RangeTypeError{Op: "rangeTypes", Type: r, Reason: "too many variables in range over"}
+			}
+			return nil, r.In(0).In(0), nil
+		}
+		if r.CanSeq2() {
+			yield := r.In(0)
+			if vars > 1 {
+				return yield.In(0), yield.In(1), nil
+			}
+			return nil, yield.In(0), nil
 		}
-	} else {
-		err := fmt.Errorf("treeTypecheck.enterWithNode: unhandled length of node.Pipe.Cmds\n%v\n%#v", node, node)
-		panic(err)
-	}
-	if newDotType == nil {
-		err := fmt.Errorf("treeTypecheck.enterWithNode: new dot type not found\n%v\n%#v", node, node)
-		panic(err)
 	}
+	return nil, nil, &RangeTypeError{Op: "rangeTypes", Type: r, Reason: "cannot range over"}
+}
+
+func (t *treeTypecheck) enterWithNode(node *parse.WithNode, state *State) bool {
+	newDotType := t.pipeType(node.Pipe, state)
+	pipeAddressable := t.isPipeAddressable(node.Pipe, state)
 	state.Add()
 	state.Enter()
 	state.AddVar(".", newDotType)
-	if len(node.Pipe.Decl) > 0 {
-		// add the new var to the new scope
-		if len(node.Pipe.Decl) == 1 {
-			state.AddVar(node.Pipe.Decl[0].Ident[0], state.Dot())
+	if pipeAddressable {
+		state.setAddressable(".")
+	}
+	t.addPipeVars(node, node.Pipe, newDotType, pipeAddressable, state)
+	return false
+}
+
+// argType returns the type of an argument node,
+// it returns nil when the type is unknown.
+// The type is recorded in the state, see State.TypeOf.
+// A number literal gets its own type, it is converted to the type of the parameter it is passed to,
+// see checkCall.
+func (t *treeTypecheck) argType(node parse.Node, state *State) reflect.Type {
+	if number, ok := node.(*parse.NumberNode); ok {
+		r, _ := numberType(number)
+		state.setType(number, r)
+		return r
+	}
+	return t.calledType(node, nil, nil, state)
+}
+
+// calledType is argType for the first argument of a command,
+// called with the other arguments args, and the result of the command final.
+func (t *treeTypecheck) calledType(node parse.Node, args []parse.Node, final *parse.CommandNode, state *State) reflect.Type {
+	var r reflect.Type
+	switch node := node.(type) {
+	case *parse.FieldNode:
+		r = t.browsePathType(node, state, node.Ident, state.Dot(), state.isAddressable("."), args, final)
+
+	case *parse.VariableNode:
+		rightVarType, found := state.lookupVar(node.Ident[0])
+		if !found {
+			err := &VariableNotFoundError{Op: "treeTypecheck.argType", Name: node.Ident[0], Node: node}
+			t.error(node, err)
+		}
+		if len(node.Ident) > 1 {
+			rightVarType = t.browsePathType(node, state, node.Ident[1:], rightVarType, state.isAddressable(node.Ident[0]), args, final)
 		} else {
-			err := fmt.Errorf("treeTypecheck.enterWithNode: unhandled length of node.Pipe.Decl\n%v\n%#v", node, node)
-			panic(err)
+			t.notAFunction(node, args, final)
 		}
+		r = rightVarType
+
+	case *parse.DotNode:
+		t.notAFunction(node, args, final)
+		r = state.Dot()
+
+	case *parse.StringNode:
+		t.notAFunction(node, args, final)
+		r = reflect.TypeOf("")
+
+	case *parse.NumberNode:
+		t.notAFunction(node, args, final)
+		var err error
+		if r, err = numberType(node); err != nil {
+			t.error(node, err)
+		}
+
+	case *parse.BoolNode:
+		t.notAFunction(node, args, final)
+		r = reflect.TypeOf(true)
+
+	case *parse.NilNode:
+		r = NilType
+
+	case *parse.IdentifierNode:
+		// a function used as an argument is called without arguments, args is empty.
+		r = t.funcCallType(node, node.Ident, args, final, state)
+
+	case *parse.PipeNode:
+		t.notAFunction(node, args, final)
+		r = t.pipeType(node, state)
+
+	case *parse.ChainNode:
+		r = t.browsePathType(node, state, node.Field, t.argType(node.Node, state), false, args, final)
 	}
-	return false
+	state.setType(node, r)
+	return r
+}
+
+// pipeType returns the type of the value produced by a pipe,
+// it is the type of its last command.
+// The types of its commands are recorded in the state.
+func (t *treeTypecheck) pipeType(pipe *parse.PipeNode, state *State) reflect.Type {
+	var r reflect.Type
+	var final *parse.CommandNode
+	for _, cmd := range pipe.Cmds {
+		r = t.cmdType(cmd, final, state)
+		final = cmd
+	}
+	state.setType(pipe, r)
+	return r
+}
+
+// cmdType returns the type of the value produced by a command,
+// final is the command piped into it, it is nil for the first command of a pipe.
+// The function calls are checked, the types of the arguments are recorded in the state.
+// nil is reported as text/template does, it is not a command.
+func (t *treeTypecheck) cmdType(cmd *parse.CommandNode, final *parse.CommandNode, state *State) reflect.Type {
+	if len(cmd.Args) == 0 {
+		return nil
+	}
+	if nilNode, ok := cmd.Args[0].(*parse.NilNode); ok {
+		err := &NilCommandError{Op: "treeTypecheck.cmdType", Node: nilNode}
+		t.error(nilNode, err)
+		return nil
+	}
+	for _, arg := range cmd.Args[1:] {
+		t.argType(arg, state)
+	}
+	r := t.calledType(cmd.Args[0], cmd.Args[1:], final, state)
+	if state.CanFail(cmd.Args[0]) {
+		state.setCanFail(cmd)
+	}
+	state.setType(cmd, r)
+	return r
 }
 
-func (t *treeTypecheck) getFuncValueType(name string) reflect.Type {
+// notAFunction reports the arguments given to a node which is not a function, or a method.
+func (t *treeTypecheck) notAFunction(node parse.Node, args []parse.Node, final *parse.CommandNode) {
+	if len(args) > 0 || final != nil {
+		err := &NotAFunctionError{Op: "treeTypecheck.notAFunction", Name: node.String()}
+		t.error(node, err)
+	}
+}
+
+// funcType returns the type of the function name,
+// the funcs take precedence over the builtins, as in text/template.
+// It returns nil when the function is unknown.
+func (t *treeTypecheck) funcType(name string) (reflect.Type, *builtin) {
 	if f, ok := t.funcs[name]; ok {
 		fR := reflect.TypeOf(f)
-		if fR.NumOut() > 0 {
-			return fR.Out(0)
+		if fR == nil || fR.Kind() != reflect.Func {
+			return nil, nil
+		}
+		return fR, nil
+	}
+	if b, ok := builtins[name]; ok {
+		return b.signature, b
+	}
+	return nil, nil
+}
+
+// funcCallType checks the call of the function name located at node,
+// with the arguments args, and the result of the command final when it is piped into the call.
+// It returns the type of the result, nil when it is unknown.
+// The unknown functions are not checked, text/template rejects them when the template is parsed.
+func (t *treeTypecheck) funcCallType(node parse.Node, name string, args []parse.Node, final *parse.CommandNode, state *State) reflect.Type {
+	fR, b := t.funcType(name)
+	if fR == nil {
+		return nil
+	}
+	if !t.checkCall(node, name, fR, args, final, state) {
+		return nil
+	}
+	if b != nil && b.result != nil {
+		argTypes := []reflect.Type{}
+		for i, arg := range args {
+			r := state.TypeOf(arg)
+			// an addressable array is sliced as a slice of its elements, see sliceType.
+			if b == builtins["slice"] && i == 0 && r != nil && r.Kind() == reflect.Array && t.isArgAddressable(arg, state) {
+				r = reflect.SliceOf(r.Elem())
+			}
+			argTypes = append(argTypes, r)
+		}
+		if final != nil {
+			argTypes = append(argTypes, state.TypeOf(final))
+		}
+		r, err := b.result(argTypes)
+		if err != nil {
+			t.error(node, &BuiltinCallError{Op: "treeTypecheck.funcCallType", Name: name, Reason: err.Error()})
+		}
+		return r
+	}
+	return fR.Out(0)
+}
+
+// checkCall checks the call of the function, or the method, name of type fR located at node,
+// with the arguments args, and the result of the command final when it is piped into the call.
+// It tells if the call is valid, the calls which return an error are recorded in the state.
+func (t *treeTypecheck) checkCall(node parse.Node, name string, fR reflect.Type, args []parse.Node, final *parse.CommandNode, state *State) bool {
+	if !isGoodFunc(fR) {
+		err := &FuncResultError{Op: "treeTypecheck.checkCall", Name: name, Type: fR}
+		t.error(node, err)
+		return false
+	}
+	if fR.NumOut() == 2 {
+		state.setCanFail(node)
+	}
+	numIn := len(args)
+	if final != nil {
+		numIn++
+	}
+	if fR.IsVariadic() && numIn < fR.NumIn()-1 || !fR.IsVariadic() && numIn != fR.NumIn() {
+		err := &FuncArgCountError{Op: "treeTypecheck.checkCall", Name: name, Want: fR.NumIn(), Got: numIn, Variadic: fR.IsVariadic()}
+		t.error(node, err)
+		return false
+	}
+	for i, arg := range args {
+		to := paramType(fR, i)
+		if number, ok := arg.(*parse.NumberNode); ok {
+			t.convertNumber(number, to, state)
 		}
+		if !isArgAssignable(arg, state.TypeOf(arg), to) {
+			err := &FuncArgTypeError{Op: "treeTypecheck.checkCall", Name: name, Arg: i + 1, Type: state.TypeOf(arg), Expected: to}
+			t.error(arg, err)
+		}
+	}
+	if final != nil {
+		to := paramType(fR, numIn-1)
+		if !isArgAssignable(final, state.TypeOf(final), to) {
+			err := &FuncArgTypeError{Op: "treeTypecheck.checkCall", Name: name, Arg: numIn, Type: state.TypeOf(final), Expected: to}
+			t.error(node, err)
+		}
+	}
+	return true
+}
+
+// errorType is the type of the error interface.
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// isGoodFunc tells if text/template can call a function, or a method, of type fR,
+// it returns one value, or one value and an error.
+func isGoodFunc(fR reflect.Type) bool {
+	switch fR.NumOut() {
+	case 1:
+		return true
+	case 2:
+		return fR.Out(1) == errorType
+	}
+	return false
+}
+
+// paramType returns the type of the parameter i of the func type fR,
+// the parameters past the last one of a variadic func have the type of its elements.
+func paramType(fR reflect.Type, i int) reflect.Type {
+	if fR.IsVariadic() && i >= fR.NumIn()-1 {
+		return fR.In(fR.NumIn() - 1).Elem()
+	}
+	return fR.In(i)
+}
+
+// reflectValueType is the type of a reflect.Value parameter, it accepts any argument.
+var reflectValueType = reflect.TypeOf((*reflect.Value)(nil)).Elem()
+
+// numberType returns the type text/template gives to a number literal outside of a call, such as in {{$x := 1.5}},
+// a complex is a complex128,
+// a float is a float64, unless it is written as an integer, a hexadecimal integer or a rune,
+// the other numbers are an int, a rune included, an unsigned number which does not fit an int is an error.
+func numberType(number *parse.NumberNode) (reflect.Type, error) {
+	switch {
+	case number.IsComplex:
+		return reflect.TypeOf(number.Complex128), nil
+	case number.IsFloat && !isHexInt(number.Text) && !isRuneInt(number.Text) && strings.ContainsAny(number.Text, ".eEpP"):
+		return reflect.TypeOf(number.Float64), nil
+	case number.IsInt:
+		if n := int(number.Int64); int64(n) != number.Int64 {
+			return nil, &NumberOverflowError{Op: "numberType", Text: number.Text}
+		}
+		return intType, nil
+	}
+	return nil, &NumberOverflowError{Op: "numberType", Text: number.Text}
+}
+
+// isRuneInt tells if a number literal is written as a rune, such as 'a'.
+func isRuneInt(s string) bool {
+	return len(s) > 0 && s[0] == '\''
+}
+
+// isHexInt tells if a number literal is written as a hexadecimal integer, such as 0x1F.
+func isHexInt(s string) bool {
+	return len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') && !strings.ContainsAny(s, "pP")
+}
+
+// convertNumber types a number literal passed to a parameter of type to.
+// Like an untyped constant of Go, it is converted to the type of the parameter,
+// {{$x := f 1}} passes a float64 to func(float64) T.
+// An empty interface, or a reflect.Value, receives the number with its own type, see numberType.
+func (t *treeTypecheck) convertNumber(number *parse.NumberNode, to reflect.Type, state *State) {
+	if to == reflectValueType || to.Kind() == reflect.Interface && to.NumMethod() == 0 {
+		if _, err := numberType(number); err != nil {
+			t.error(number, err)
+		}
+		return
+	}
+	if isArgAssignable(number, nil, to) {
+		state.setType(number, to)
+	}
+}
+
+// isArgAssignable tells if the argument arg, of type r, can be passed to a parameter of type to.
+// Like text/template, the constants are converted to the kind of the parameter,
+// a pointer is dereferenced, and a value is addressed, to match the parameter.
+func isArgAssignable(arg parse.Node, r reflect.Type, to reflect.Type) bool {
+	if to == reflectValueType {
+		return true
+	}
+	emptyInterface := to.Kind() == reflect.Interface && to.NumMethod() == 0
+	switch arg := arg.(type) {
+	case *parse.StringNode:
+		return to.Kind() == reflect.String || emptyInterface
+	case *parse.BoolNode:
+		return to.Kind() == reflect.Bool || emptyInterface
+	case *parse.NumberNode:
+		switch to.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return arg.IsInt
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return arg.IsUint
+		case reflect.Float32, reflect.Float64:
+			return arg.IsFloat
+		case reflect.Complex64, reflect.Complex128:
+			return arg.IsComplex
+		}
+		return emptyInterface
+	}
+	if isAssignable(r, to) {
+		return true
+	}
+	if r.Kind() == reflect.Ptr && r.Elem().AssignableTo(to) {
+		return true
 	}
-	return nil
+	return reflect.PtrTo(r).AssignableTo(to)
 }
@@ -1,10 +1,14 @@
 package simplifier_test
 
 import (
+	"errors"
+	"fmt"
+	"iter"
 	"reflect"
 	"strings"
 	"testing"
 	"text/template"
+	"text/template/parse"
 
 	"github.com/mh-cbon/template-tree-simplifier/simplifier"
 )
@@ -38,6 +42,21 @@ type type7 struct {
 	Some []*type7
 }
 
+type type8 struct {
+	Map  map[string]int
+	Chan chan type2
+	N    int8
+	Seq  iter.Seq[type2]
+	Seq2 iter.Seq2[string, int]
+}
+
+var type8Data = type8{
+	Map:  map[string]int{"a": 1, "b": 2},
+	N:    2,
+	Seq:  func(yield func(type2) bool) { yield(type2{Some: "s"}) },
+	Seq2: func(yield func(string, int) bool) { yield("k", 1) },
+}
+
 func (t type4) Method() interface{}        { return nil }
 func (t type4) MethodArgs(a string) string { return "" }
 
@@ -470,6 +489,84 @@ func TestTypeCheck(t *testing.T) {
 				},
 			},
 		},
+		TestData{
+			tplstr:       `{{range $k, $v := .Map}}{{$k}}{{$v}}{{range $.Map}}{{.}}{{end}}{{end}}`,
+			expectTplStr: `{{$var0 := .Map}}{{range $tplK, $tplV := $var0}}{{$tplK}}{{$tplV}}{{$var1 := $.Map}}{{range $var1}}{{.}}{{end}}{{end}}`,
+			funcs:        defFuncs,
+			typecheck:    true,
+			data:         type8Data,
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type8{}),
+					"$var0": reflect.TypeOf(map[string]int{}),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(1),
+					"$tplK": reflect.TypeOf(""),
+					"$tplV": reflect.TypeOf(1),
+					"$var1": reflect.TypeOf(map[string]int{}),
+				},
+				map[string]reflect.Type{
+					".": reflect.TypeOf(1),
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{range $v := .Chan}}{{$v.Some}}{{else}}{{range $i := $.N}}{{$i}}{{end}}{{end}}`,
+			expectTplStr: `{{$var0 := .Chan}}{{range $tplV := $var0}}{{$var1 := $tplV.Some}}{{$var1}}{{else}}{{$var2 := $.N}}{{range $tplI := $var2}}{{$tplI}}{{end}}{{end}}`,
+			funcs:        defFuncs,
+			typecheck:    true,
+			data:         type8Data,
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type8{}),
+					"$var0": reflect.TypeOf(make(chan type2)),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type2{}),
+					"$tplV": reflect.TypeOf(type2{}),
+					"$var1": reflect.TypeOf(""),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type8{}),
+					"$tplV": reflect.TypeOf(make(chan type2)),
+					"$var2": reflect.TypeOf(int8(0)),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(int8(0)),
+					"$tplI": reflect.TypeOf(int8(0)),
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{range $v := .Seq}}{{$v.Some}}{{range $k, $w := $.Seq2}}{{$k}}{{$w}}{{range $j := $.Seq2}}{{$j}}{{end}}{{end}}{{end}}`,
+			expectTplStr: `{{$var0 := .Seq}}{{range $tplV := $var0}}{{$var1 := $tplV.Some}}{{$var1}}{{$var2 := $.Seq2}}{{range $tplK, $tplW := $var2}}{{$tplK}}{{$tplW}}{{$var3 := $.Seq2}}{{range $tplJ := $var3}}{{$tplJ}}{{end}}{{end}}{{end}}`,
+			funcs:        defFuncs,
+			typecheck:    true,
+			data:         type8Data,
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type8{}),
+					"$var0": reflect.TypeOf(type8Data.Seq),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type2{}),
+					"$tplV": reflect.TypeOf(type2{}),
+					"$var1": reflect.TypeOf(""),
+					"$var2": reflect.TypeOf(type8Data.Seq2),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(1),
+					"$tplK": reflect.TypeOf(""),
+					"$tplW": reflect.TypeOf(1),
+					"$var3": reflect.TypeOf(type8Data.Seq2),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(""),
+					"$tplJ": reflect.TypeOf(""),
+				},
+			},
+		},
 		TestData{
 			tplstr:       `{{$x := "e"}}{{define "rr"}}{{$x := "x"}}{{end}}{{template "rr" $x}}`,
 			expectTplStr: `{{$tplX := "e"}}{{template "rr" $tplX}}`,
@@ -483,6 +580,235 @@ func TestTypeCheck(t *testing.T) {
 				},
 			},
 		},
+		TestData{
+			tplstr:       `{{$x := eq .Some nil}}`,
+			expectTplStr: `{{$var0 := .Some}}{{$tplX := eq $var0 nil}}`,
+			funcs:        defFuncs,
+			typecheck:    true,
+			data:         type5{},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type5{}),
+					"$var0": reflect.TypeOf(&type3{}),
+					"$tplX": reflect.TypeOf(true),
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{$x := (first .Some).Some}}`,
+			expectTplStr: `{{$var1 := .Some}}{{$var0 := first $var1}}{{$tplX := $var0.Some}}`,
+			funcs: template.FuncMap{
+				"first": func(s []type1) type1 { return s[0] },
+			},
+			typecheck: true,
+			data:      type6{Some: []type1{type1{}}},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type6{}),
+					"$var0": reflect.TypeOf(type1{}),
+					"$var1": reflect.TypeOf([]type1{}),
+					"$tplX": reflect.TypeOf([]string{}),
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{$x := "a"}}{{if true}}{{$x = up .Some}}{{end}}{{$x}}`,
+			expectTplStr: `{{$tplX := "a"}}{{if true}}{{$var0 := .Some}}{{$tplX = up $var0}}{{end}}{{$tplX}}`,
+			funcs:        defFuncs,
+			typecheck:    true,
+			data:         type2{Some: "b"},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type2{}),
+					"$tplX": reflect.TypeOf(""),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type2{}),
+					"$var0": reflect.TypeOf(""),
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{range $i, $v := .}}{{if eq $v "b"}}{{continue}}{{end}}{{$x := up $v}}{{if eq $x "C"}}{{break}}{{end}}{{end}}`,
+			expectTplStr: `{{$var0 := .}}{{range $tplI, $tplV := $var0}}{{$var1 := eq $tplV "b"}}{{if $var1}}{{continue}}{{end}}{{$tplX := up $tplV}}{{$var2 := eq $tplX "C"}}{{if $var2}}{{break}}{{end}}{{end}}`,
+			funcs:        defFuncs,
+			typecheck:    true,
+			data:         []string{"a", "b", "c"},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf([]string{}),
+					"$var0": reflect.TypeOf([]string{}),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(""),
+					"$tplI": reflect.TypeOf(1),
+					"$tplV": reflect.TypeOf(""),
+					"$var1": reflect.TypeOf(true),
+					"$tplX": reflect.TypeOf(""),
+					"$var2": reflect.TypeOf(true),
+				},
+				map[string]reflect.Type{
+					".": reflect.TypeOf(""),
+				},
+				map[string]reflect.Type{
+					".": reflect.TypeOf(""),
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{range $v := .Chan}}{{$v.Some}}{{end}}{{range $i := .N}}{{$i}}{{end}}`,
+			expectTplStr: `{{$var0 := .Chan}}{{range $tplV := $var0}}{{$var1 := $tplV.Some}}{{$var1}}{{end}}{{$var2 := .N}}{{range $tplI := $var2}}{{$tplI}}{{end}}`,
+			funcs:        defFuncs,
+			typecheck:    true,
+			data:         type8Data,
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type8{}),
+					"$var0": reflect.TypeOf(make(chan type2)),
+					"$var2": reflect.TypeOf(int8(0)),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type2{}),
+					"$tplV": reflect.TypeOf(type2{}),
+					"$var1": reflect.TypeOf(""),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(int8(0)),
+					"$tplI": reflect.TypeOf(int8(0)),
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{range $i, $v := .Chan}}{{$i}}{{$v.Some}}{{end}}`,
+			expectTplStr: `{{$var0 := .Chan}}{{range $tplI, $tplV := $var0}}{{$tplI}}{{$var1 := $tplV.Some}}{{$var1}}{{end}}`,
+			funcs:        defFuncs,
+			typecheck:    true,
+			data:         type8Data,
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type8{}),
+					"$var0": reflect.TypeOf(make(chan type2)),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type2{}),
+					"$tplI": reflect.TypeOf(0),
+					"$tplV": reflect.TypeOf(type2{}),
+					"$var1": reflect.TypeOf(""),
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{range $i, $e := .Some}}{{$e}}{{else}}{{printf "%T" $i}}{{end}}`,
+			expectTplStr: `{{$var0 := .Some}}{{range $tplI, $tplE := $var0}}{{$tplE}}{{else}}{{$var1 := printf "%T" $tplI}}{{$var1}}{{end}}`,
+			funcs:        defFuncs,
+			typecheck:    true,
+			data:         type1{Some: []string{}},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type1{}),
+					"$var0": reflect.TypeOf([]string{}),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(""),
+					"$tplI": reflect.TypeOf(0),
+					"$tplE": reflect.TypeOf(""),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type1{}),
+					"$tplI": reflect.TypeOf([]string{}),
+					"$tplE": reflect.TypeOf([]string{}),
+					"$var1": reflect.TypeOf(""),
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{with $x := .Some}}{{up .}}{{else}}{{up $x}}{{.Some}}{{end}}`,
+			expectTplStr: `{{$var0 := .Some}}{{with $tplX := $var0}}{{$var1 := up .}}{{$var1}}{{else}}{{$var2 := up $tplX}}{{$var2}}{{$var3 := .Some}}{{$var3}}{{end}}`,
+			funcs:        defFuncs,
+			typecheck:    true,
+			data:         type2{Some: "b"},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type2{}),
+					"$var0": reflect.TypeOf(""),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(""),
+					"$tplX": reflect.TypeOf(""),
+					"$var1": reflect.TypeOf(""),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type2{}),
+					"$tplX": reflect.TypeOf(""),
+					"$var2": reflect.TypeOf(""),
+					"$var3": reflect.TypeOf(""),
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{.FullName}}`,
+			expectTplStr: `{{$var0 := .FullName}}{{$var0}}`,
+			funcs:        defFuncs,
+			typecheck:    true,
+			data:         &type13{Name: "a"},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(&type13{}),
+					"$var0": reflect.TypeOf(""),
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{$v := .}}{{$v.FullName}}`,
+			expectTplStr: `{{$tplV := .}}{{$var0 := $tplV.FullName}}{{$var0}}`,
+			funcs:        defFuncs,
+			typecheck:    true,
+			data:         &type13{Name: "a"},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(&type13{}),
+					"$tplV": reflect.TypeOf(&type13{}),
+					"$var0": reflect.TypeOf(""),
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{range $i, $u := .}}{{.FullName}}{{$u.FullName}}{{end}}`,
+			expectTplStr: `{{$var0 := .}}{{range $tplI, $tplU := $var0}}{{$var1 := .FullName}}{{$var1}}{{$var2 := $tplU.FullName}}{{$var2}}{{end}}`,
+			funcs:        defFuncs,
+			typecheck:    true,
+			data:         []type13{{Name: "a"}},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf([]type13{}),
+					"$var0": reflect.TypeOf([]type13{}),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type13{}),
+					"$tplI": reflect.TypeOf(0),
+					"$tplU": reflect.TypeOf(type13{}),
+					"$var1": reflect.TypeOf(""),
+					"$var2": reflect.TypeOf(""),
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{with .User}}{{.FullName}}{{end}}`,
+			expectTplStr: `{{$var0 := .User}}{{with $var0}}{{$var1 := .FullName}}{{$var1}}{{end}}`,
+			funcs:        defFuncs,
+			typecheck:    true,
+			data:         type15{User: &type13{Name: "a"}},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type15{}),
+					"$var0": reflect.TypeOf(&type13{}),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(&type13{}),
+					"$var1": reflect.TypeOf(""),
+				},
+			},
+		},
 	}
 
 	for i, testData := range testTable {
@@ -497,12 +823,700 @@ func typechecktemplate(t *template.Template, testData TestData) (*template.Templ
 	if err != nil {
 		panic(err)
 	}
-	var typeCheck *simplifier.State
+	trees := map[string]*parse.Tree{}
 	for _, t := range ret.Templates() {
 		if t.Tree != nil {
 			simplifier.Simplify(t.Tree)
-			typeCheck = simplifier.TypeCheck(t.Tree, testData.data, testData.funcs)
+			trees[t.Name()] = t.Tree
+		}
+	}
+	states, _ := simplifier.TypeCheckTemplates(trees, ret.Name(), testData.data, testData.funcs)
+	return ret, states[ret.Name()][0]
+}
+
+func TestTypeCheckAll(t *testing.T) {
+	//-
+	defFuncs := template.FuncMap{
+		"up": strings.ToUpper,
+	}
+	tplstr := `{{$x := .Nope}}{{$y := $x.Some}}{{$z := .Other}}{{range $r := .Missing}}{{$w := .Some}}{{end}}{{$k := .Some}}`
+	tpl, err := template.New("").Funcs(defFuncs).Parse(tplstr)
+	if err != nil {
+		t.Fatalf("Failed to compiling original template: %v", err)
+	}
+	simplifier.Simplify(tpl.Tree)
+	typeCheck, diagnostics := simplifier.TypeCheckAll(tpl.Tree, type2{}, defFuncs)
+
+	expectMessages := []string{
+		"path [Nope] not found in type simplifier_test.type2",
+		"path [Other] not found in type simplifier_test.type2",
+		"path [Missing] not found in type simplifier_test.type2",
+	}
+	if len(diagnostics) != len(expectMessages) {
+		t.Fatalf("Unexpected number of diagnostics, expected=%v, got=%v\n%v", len(expectMessages), len(diagnostics), diagnostics)
+	}
+	for i, d := range diagnostics {
+		if d.Message != expectMessages[i] {
+			t.Errorf("Unexpected diagnostic(%v)\nexpected=%v\ngot     =%v", i, expectMessages[i], d.Message)
+		}
+	}
+
+	expectScopes := []map[string]reflect.Type{
+		map[string]reflect.Type{
+			".":     reflect.TypeOf(type2{}),
+			"$tplX": nil,
+			"$tplY": nil,
+			"$tplZ": nil,
+			"$var0": nil,
+			"$tplK": reflect.TypeOf(""),
+		},
+		map[string]reflect.Type{
+			".":     nil,
+			"$tplR": nil,
+			"$tplW": nil,
+		},
+	}
+	if len(expectScopes) != typeCheck.Len() {
+		t.Fatalf("Unexpected typechecker number of scopes, expected=%v, got=%v", len(expectScopes), typeCheck.Len())
+	}
+	for i, scope := range expectScopes {
+		typeCheck.Enter()
+		if len(scope) != len(typeCheck.Current()) {
+			t.Errorf("Unexpected variables in scope(%v), expected=%v, got=%v", i, scope, typeCheck.Current())
+		}
+		for vard, typed := range scope {
+			if typeCheck.HasVar(vard) == false {
+				t.Errorf("Expected scope(%v) to contain the variable=%v", i, vard)
+			} else if typed != typeCheck.GetVar(vard) {
+				t.Errorf("Expected scope(%v) to contain the variable=%v with the same reflect.Type, expected=%v, got=%v",
+					i, vard, typed, typeCheck.GetVar(vard))
+			}
+		}
+	}
+}
+
+func TestIsNilAssignable(t *testing.T) {
+	var x []interface{}
+	assignables := []reflect.Type{
+		simplifier.NilType,
+		reflect.TypeOf(&type3{}),
+		reflect.TypeOf(x).Elem(),
+		reflect.TypeOf([]string{}),
+		reflect.TypeOf(map[string]string{}),
+	}
+	for _, r := range assignables {
+		if !simplifier.IsNilAssignable(r) {
+			t.Errorf("expected nil to be assignable to %v", r)
+		}
+	}
+	notAssignables := []reflect.Type{
+		nil,
+		reflect.TypeOf(""),
+		reflect.TypeOf(type3{}),
+	}
+	for _, r := range notAssignables {
+		if simplifier.IsNilAssignable(r) {
+			t.Errorf("expected nil not to be assignable to %v", r)
+		}
+	}
+}
+
+func TestTypeCheckChain(t *testing.T) {
+	funcs := template.FuncMap{
+		"first": func(s []type1) type1 { return s[0] },
+	}
+	tpl := template.Must(template.New("").Funcs(funcs).Parse(`{{$x := (first .Some).Some}}`))
+	// the tree is not simplified, the chain is typed as is.
+	state := simplifier.TypeCheck(tpl.Tree, type6{}, funcs)
+	state.Enter()
+	if got := state.GetVar("$x"); got != reflect.TypeOf([]string{}) {
+		t.Errorf("unexpected type of $x, expected=%v, got=%v", reflect.TypeOf([]string{}), got)
+	}
+}
+
+func TestTypeCheckRange(t *testing.T) {
+	tests := []struct {
+		tplstr  string
+		data    interface{}
+		message string
+	}{
+		{`{{range .Some}}{{end}}`, type2{}, "cannot range over string"},
+		{`{{range $i, $v := .N}}{{end}}`, type8{}, "too many variables in range over int8"},
+		{`{{range $i, $v := .Seq}}{{end}}`, type8{}, "too many variables in range over " + reflect.TypeOf(type8{}.Seq).String()},
+		{`{{range .Send}}{{end}}`, struct{ Send chan<- int }{}, "cannot range over send-only channel chan<- int"},
+	}
+	for i, test := range tests {
+		tpl := template.Must(template.New("").Parse(test.tplstr))
+		simplifier.Simplify(tpl.Tree)
+		_, diagnostics := simplifier.TypeCheckAll(tpl.Tree, test.data, nil)
+		if len(diagnostics) != 1 {
+			t.Errorf("Test(%v): expected a diagnostic, got %v", i, diagnostics)
+			continue
+		}
+		var rangeErr *simplifier.RangeTypeError
+		if !errors.As(diagnostics[0], &rangeErr) {
+			t.Errorf("Test(%v): expected a *RangeTypeError, got %T", i, diagnostics[0].Err)
+		}
+		if diagnostics[0].Message != test.message {
+			t.Errorf("Test(%v): unexpected message\nexpected=%v\ngot     =%v", i, test.message, diagnostics[0].Message)
+		}
+	}
+}
+
+func TestTypeCheckPipes(t *testing.T) {
+	funcs := template.FuncMap{
+		"split": strings.Split,
+		"up":    strings.ToUpper,
+		"lower": strings.ToLower,
+	}
+	tpl := template.Must(template.New("").Funcs(funcs).Parse(
+		`{{$s := .Some | up}}{{range $i, $v := split $s ","}}{{with $m := $.Method $v}}{{$u := $m | lower}}{{end}}{{end}}`))
+	// the tree is not simplified, the pipes are typed as is.
+	state := simplifier.TypeCheck(tpl.Tree, tplData{}, funcs)
+	expectScopes := []map[string]reflect.Type{
+		map[string]reflect.Type{
+			".":  reflect.TypeOf(tplData{}),
+			"$s": reflect.TypeOf(""),
+		},
+		map[string]reflect.Type{
+			".":  reflect.TypeOf(""),
+			"$i": reflect.TypeOf(1),
+			"$v": reflect.TypeOf(""),
+		},
+		map[string]reflect.Type{
+			".":  reflect.TypeOf(""),
+			"$m": reflect.TypeOf(""),
+			"$u": reflect.TypeOf(""),
+		},
+	}
+	if len(expectScopes) != state.Len() {
+		t.Fatalf("Unexpected typechecker number of scopes, expected=%v, got=%v", len(expectScopes), state.Len())
+	}
+	for i, scope := range expectScopes {
+		state.Enter()
+		if len(scope) != len(state.Current()) {
+			t.Errorf("Unexpected variables in scope(%v), expected=%v, got=%v", i, scope, state.Current())
+		}
+		for vard, typed := range scope {
+			if got := state.GetVar(vard); got != typed {
+				t.Errorf("Expected scope(%v) to contain the variable=%v with the same reflect.Type, expected=%v, got=%v",
+					i, vard, typed, got)
+			}
+		}
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	funcs := template.FuncMap{
+		"split": strings.Split,
+		"up":    strings.ToUpper,
+	}
+	tpl := template.Must(template.New("").Funcs(funcs).Parse(`{{if .Some}}{{split (up .Some) ","}}{{end}}`))
+	// the tree is not simplified, the nodes are typed as is.
+	state := simplifier.TypeCheck(tpl.Tree, type2{}, funcs)
+
+	ifNode := tpl.Tree.Root.Nodes[0].(*parse.IfNode)
+	action := ifNode.List.Nodes[0].(*parse.ActionNode)
+	cmd := action.Pipe.Cmds[0]
+	sub := cmd.Args[1].(*parse.PipeNode)
+	stringType := reflect.TypeOf("")
+	sliceType := reflect.TypeOf([]string{})
+	tests := []struct {
+		node   parse.Node
+		expect reflect.Type
+	}{
+		{ifNode.Pipe, stringType},
+		{ifNode.Pipe.Cmds[0].Args[0], stringType},
+		{action.Pipe, sliceType},
+		{cmd, sliceType},
+		{cmd.Args[0], sliceType},
+		{sub, stringType},
+		{sub.Cmds[0].Args[1], stringType},
+		{cmd.Args[2], stringType},
+		{ifNode, nil},
+	}
+	for i, test := range tests {
+		if got := state.TypeOf(test.node); got != test.expect {
+			t.Errorf("Test(%v): unexpected type of %v, expected=%v, got=%v", i, test.node, test.expect, got)
+		}
+	}
+}
+
+func TestTypeCheckFuncCalls(t *testing.T) {
+	funcs := template.FuncMap{
+		"split":  strings.Split,
+		"up":     strings.ToUpper,
+		"join":   func(sep string, s ...string) string { return strings.Join(s, sep) },
+		"add":    func(a, b int64) int64 { return a + b },
+		"any":    func(v interface{}) string { return "" },
+		"deref":  func(v type2) string { return v.Some },
+		"some":   func() *type2 { return &type2{} },
+		"method": func(v fmt.Stringer) string { return v.String() },
+	}
+	tests := []struct {
+		tplstr  string
+		message string
+	}{
+		{`{{split "a" ","}}`, ""},
+		{`{{"a" | split ","}}`, ""},
+		{`{{join "," "a" "b"}}`, ""},
+		{`{{join ","}}`, ""},
+		{`{{add 1 2}}`, ""},
+		{`{{any nil}}{{any 1}}{{any .}}`, ""},
+		{`{{deref some}}{{some | deref}}`, ""},
+		{`{{up .Some | split ","}}`, ""},
+		{`{{split 1}}`, "wrong number of args for split: want 2 got 1"},
+		{`{{"a" | split "," ","}}`, "wrong number of args for split: want 2 got 3"},
+		{`{{join}}`, "wrong number of args for join: want at least 1 got 0"},
+		{`{{split 1 ","}}`, "wrong type for arg 1 of split: expected string, got int"},
+		{`{{join "," "a" true}}`, "wrong type for arg 3 of join: expected string, got bool"},
+		{`{{add 1 "2"}}`, "wrong type for arg 2 of add: expected int64, got string"},
+		{`{{. | up}}`, "wrong type for arg 1 of up: expected string, got simplifier_test.type2"},
+		{`{{up nil}}`, "wrong type for arg 1 of up: expected string, got nil"},
+		{`{{method .}}`, "wrong type for arg 1 of method: expected fmt.Stringer, got simplifier_test.type2"},
+		{`{{any up}}`, "wrong number of args for up: want 1 got 0"},
+		{`{{nil}}`, "nil is not a command"},
+		{`{{nil | print}}`, "nil is not a command"},
+		{`{{$x := nil}}`, "nil is not a command"},
+	}
+	for i, test := range tests {
+		tpl := template.Must(template.New("").Funcs(funcs).Parse(test.tplstr))
+		_, diagnostics := simplifier.TypeCheckAll(tpl.Tree, type2{}, funcs)
+		if test.message == "" {
+			if len(diagnostics) > 0 {
+				t.Errorf("Test(%v): unexpected diagnostics %v", i, diagnostics)
+			}
+			continue
+		}
+		if len(diagnostics) != 1 {
+			t.Errorf("Test(%v): expected a diagnostic, got %v", i, diagnostics)
+			continue
+		}
+		if diagnostics[0].Message != test.message {
+			t.Errorf("Test(%v): unexpected message\nexpected=%v\ngot     =%v", i, test.message, diagnostics[0].Message)
+		}
+	}
+}
+
+type type9 struct {
+	S   []string
+	A   [2]int
+	M   map[string]type2
+	P   *[]string
+	U   uint
+	F   float64
+	Str string
+	Fn  func(string, int) type2
+	I   interface{}
+	Ptr *type9
+}
+
+func TestTypeCheckBuiltins(t *testing.T) {
+	tests := []struct {
+		tplstr  string
+		expect  reflect.Type
+		message string
+	}{
+		{`{{$x := eq .Str "a" "b"}}`, reflect.TypeOf(true), ""},
+		{`{{$x := lt .U 2}}`, reflect.TypeOf(true), ""},
+		{`{{$x := len .P}}`, reflect.TypeOf(0), ""},
+		{`{{$x := index .S 1}}`, reflect.TypeOf(""), ""},
+		{`{{$x := index .S 1 0}}`, reflect.TypeOf(byte(0)), ""},
+		{`{{$x := index .M "a"}}`, reflect.TypeOf(type2{}), ""},
+		{`{{$x := index .P .U}}`, reflect.TypeOf(""), ""},
+		{`{{$x := index .I 1}}`, nil, ""},
+		{`{{$x := slice .Ptr.A 1}}`, reflect.TypeOf([]int{}), ""},
+		{`{{$x := eq .S nil}}`, reflect.TypeOf(true), ""},
+		{`{{$x := slice .Str 1 2}}`, reflect.TypeOf(""), ""},
+		{`{{$x := printf "%v" .}}`, reflect.TypeOf(""), ""},
+		{`{{$x := .Str | html}}`, reflect.TypeOf(""), ""},
+		{`{{$x := and .Str .Str}}`, reflect.TypeOf(""), ""},
+		{`{{$x := or .Str .U}}`, reflect.TypeOf((*interface{})(nil)).Elem(), ""},
+		{`{{$x := not .Str}}`, reflect.TypeOf(true), ""},
+		{`{{$x := call .Fn "a" 1}}`, reflect.TypeOf(type2{}), ""},
+		{`{{$x := eq .Str}}`, reflect.TypeOf(true), "error calling eq: missing argument for comparison"},
+		{`{{$x := eq .Str 1}}`, reflect.TypeOf(true), "error calling eq: incompatible types for comparison"},
+		{`{{$x := lt .F .U}}`, reflect.TypeOf(true), "error calling lt: incompatible types for comparison"},
+		{`{{$x := gt .S .S}}`, reflect.TypeOf(true), "error calling gt: invalid type for comparison"},
+		{`{{$x := len .U}}`, reflect.TypeOf(0), "error calling len: len of type uint"},
+		{`{{$x := index .S "a"}}`, nil, "error calling index: cannot index slice/array with type string"},
+		{`{{$x := index .M 1}}`, nil, "error calling index: value has type int; should be string"},
+		{`{{$x := index .M nil}}`, nil, "error calling index: value has type nil; should be string"},
+		{`{{$x := index .U 1}}`, nil, "error calling index: can't index item of type uint"},
+		{`{{$x := slice .Str 1 2 3}}`, nil, "error calling slice: cannot 3-index slice a string"},
+		{`{{$x := slice .A 1}}`, nil, "error calling slice: slice of unaddressable array"},
+		{`{{$x := eq .S .S}}`, reflect.TypeOf(true), "error calling eq: non-comparable type []string"},
+		{`{{$x := eq .M .M}}`, reflect.TypeOf(true), "error calling eq: non-comparable type map[string]simplifier_test.type2"},
+		{`{{$x := printf 1}}`, reflect.TypeOf(""), "wrong type for arg 1 of printf: expected string, got int"},
+		{`{{$x := call .Fn "a"}}`, nil, "error calling call: wrong number of args: want 2 got 1"},
+		{`{{$x := call .Str}}`, nil, "error calling call: non-function of type string"},
+	}
+	for i, test := range tests {
+		tpl := template.Must(template.New("").Parse(test.tplstr))
+		state, diagnostics := simplifier.TypeCheckAll(tpl.Tree, type9{}, nil)
+		if test.message == "" && len(diagnostics) > 0 {
+			t.Errorf("Test(%v): unexpected diagnostics %v", i, diagnostics)
+		} else if test.message != "" && len(diagnostics) != 1 {
+			t.Errorf("Test(%v): expected a diagnostic, got %v", i, diagnostics)
+		} else if test.message != "" && diagnostics[0].Message != test.message {
+			t.Errorf("Test(%v): unexpected message\nexpected=%v\ngot     =%v", i, test.message, diagnostics[0].Message)
+		}
+		state.Enter()
+		if got := state.GetVar("$x"); got != test.expect {
+			t.Errorf("Test(%v): unexpected type of $x, expected=%v, got=%v", i, test.expect, got)
+		}
+	}
+}
+
+func TestTypeCheckFuncResults(t *testing.T) {
+	funcs := template.FuncMap{
+		"fnWithErr": func(a string) (string, error) { return a, nil },
+		"up":        strings.ToUpper,
+	}
+	tpl := template.Must(template.New("").Funcs(funcs).Parse(`{{$x := fnWithErr "a" | up}}{{$y := index .Some 0}}{{up fnWithErr}}`))
+	state, diagnostics := simplifier.TypeCheckAll(tpl.Tree, type1{}, funcs)
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected a diagnostic, got %v", diagnostics)
+	}
+	expected := "wrong number of args for fnWithErr: want 1 got 0"
+	if diagnostics[0].Message != expected {
+		t.Errorf("unexpected message\nexpected=%v\ngot     =%v", expected, diagnostics[0].Message)
+	}
+	state.Enter()
+	if got := state.GetVar("$x"); got != reflect.TypeOf("") {
+		t.Errorf("unexpected type of $x, expected=%v, got=%v", reflect.TypeOf(""), got)
+	}
+	x := tpl.Tree.Root.Nodes[0].(*parse.ActionNode).Pipe.Cmds
+	y := tpl.Tree.Root.Nodes[1].(*parse.ActionNode).Pipe.Cmds
+	z := tpl.Tree.Root.Nodes[2].(*parse.ActionNode).Pipe.Cmds
+	tests := []struct {
+		node   parse.Node
+		expect bool
+	}{
+		{x[0], true},
+		{x[1], false},
+		{y[0], true},
+		{z[0], false},
+		{z[0].Args[1], true},
+	}
+	for i, test := range tests {
+		if got := state.CanFail(test.node); got != test.expect {
+			t.Errorf("Test(%v): unexpected CanFail of %v, expected=%v, got=%v", i, test.node, test.expect, got)
+		}
+	}
+
+	// text/template refuses to install such funcs, the template is parsed with others.
+	badFuncs := template.FuncMap{
+		"void": func() {},
+		"two":  func() (string, string) { return "", "" },
+	}
+	for _, tplstr := range []string{`{{void}}`, `{{two}}`} {
+		tpl := template.Must(template.New("").Funcs(template.FuncMap{"void": strings.ToUpper, "two": strings.ToUpper}).Parse(tplstr))
+		_, diagnostics := simplifier.TypeCheckAll(tpl.Tree, nil, badFuncs)
+		var resultErr *simplifier.FuncResultError
+		if len(diagnostics) != 1 || !errors.As(diagnostics[0], &resultErr) {
+			t.Errorf("%v: expected a *FuncResultError, got %v", tplstr, diagnostics)
+		}
+	}
+}
+
+type type11 struct {
+	Name string
+}
+
+func (t type11) Join(sep string, s ...string) string { return strings.Join(s, sep) }
+func (t type11) Get(i int) (type2, error)            { return type2{}, nil }
+func (t type11) Self() type11                        { return t }
+func (t type11) Void()                               {}
+
+func TestTypeCheckMethods(t *testing.T) {
+	tests := []struct {
+		tplstr  string
+		expect  reflect.Type
+		message string
+	}{
+		{`{{$x := .Join "," "a" "b"}}`, reflect.TypeOf(""), ""},
+		{`{{$x := .Self.Join ","}}`, reflect.TypeOf(""), ""},
+		{`{{$x := "a" | .Join ","}}`, reflect.TypeOf(""), ""},
+		{`{{$x := .Get 1}}`, reflect.TypeOf(type2{}), ""},
+		{`{{$x := (.Get 1).Some}}`, reflect.TypeOf(""), ""},
+		{`{{$v := .}}{{$x := $v.Join ","}}`, reflect.TypeOf(""), ""},
+		{`{{$x := .Join}}`, nil, "wrong number of args for Join: want at least 1 got 0"},
+		{`{{$x := .Get}}`, nil, "wrong number of args for Get: want 1 got 0"},
+		{`{{$x := .Join 1}}`, reflect.TypeOf(""), "wrong type for arg 1 of Join: expected string, got int"},
+		{`{{$x := .Get 1 | .Join ","}}`, reflect.TypeOf(""), "wrong type for arg 2 of Join: expected string, got simplifier_test.type2"},
+		{`{{$x := .Self.Void}}`, nil, "function Void of type func() must return one value, or one value and an error"},
+		{`{{$x := .Name "a"}}`, nil, "can't give argument to non-function Name"},
+		{`{{$x := "a" | .Self.Name}}`, nil, "can't give argument to non-function Name"},
+		{`{{$x := .Nope "a"}}`, nil, "path [Nope] not found in type simplifier_test.type11"},
+	}
+	for i, test := range tests {
+		tpl := template.Must(template.New("").Parse(test.tplstr))
+		state, diagnostics := simplifier.TypeCheckAll(tpl.Tree, type11{}, nil)
+		if test.message == "" && len(diagnostics) > 0 {
+			t.Errorf("Test(%v): unexpected diagnostics %v", i, diagnostics)
+		} else if test.message != "" && len(diagnostics) != 1 {
+			t.Errorf("Test(%v): expected a diagnostic, got %v", i, diagnostics)
+		} else if test.message != "" && diagnostics[0].Message != test.message {
+			t.Errorf("Test(%v): unexpected message\nexpected=%v\ngot     =%v", i, test.message, diagnostics[0].Message)
+		}
+		state.Enter()
+		if got := state.GetVar("$x"); got != test.expect {
+			t.Errorf("Test(%v): unexpected type of $x, expected=%v, got=%v", i, test.expect, got)
+		}
+	}
+
+	tpl := template.Must(template.New("").Parse(`{{.Get 1}}{{(.Get 1).Some}}{{.Self.Name}}`))
+	state := simplifier.TypeCheck(tpl.Tree, type11{}, nil)
+	// the call of the chain is the command of its pipe.
+	chain := tpl.Tree.Root.Nodes[1].(*parse.ActionNode).Pipe.Cmds[0].Args[0].(*parse.ChainNode)
+	cmds := []*parse.CommandNode{
+		tpl.Tree.Root.Nodes[0].(*parse.ActionNode).Pipe.Cmds[0],
+		chain.Node.(*parse.PipeNode).Cmds[0],
+		tpl.Tree.Root.Nodes[1].(*parse.ActionNode).Pipe.Cmds[0],
+		tpl.Tree.Root.Nodes[2].(*parse.ActionNode).Pipe.Cmds[0],
+	}
+	for i, expect := range []bool{true, true, false, false} {
+		if got := state.CanFail(cmds[i]); got != expect {
+			t.Errorf("Test(%v): unexpected CanFail of %v, expected=%v, got=%v", i, cmds[i], expect, got)
+		}
+	}
+}
+
+type type12 struct {
+	Config map[string]type2
+	Any    map[string]interface{}
+	ByInt  map[int]string
+}
+
+func TestTypeCheckMaps(t *testing.T) {
+	tests := []struct {
+		tplstr  string
+		expect  reflect.Type
+		message string
+	}{
+		{`{{$x := .Config.db}}`, reflect.TypeOf(type2{}), ""},
+		{`{{$x := .Config.db.Some}}`, reflect.TypeOf(""), ""},
+		{`{{$v := .Config}}{{$x := $v.db.Some}}`, reflect.TypeOf(""), ""},
+		{`{{$x := .Any.db.host}}`, reflect.TypeOf((*interface{})(nil)).Elem(), ""},
+		{`{{$x := .Config.db "a"}}`, nil, "can't give argument to non-function db"},
+		{`{{$x := .Config.db.Nope}}`, nil, "path [Config db Nope] not found in type simplifier_test.type2"},
+		{`{{$x := .ByInt.a}}`, nil, "path [ByInt a] not found in type map[int]string"},
+	}
+	for i, test := range tests {
+		tpl := template.Must(template.New("").Parse(test.tplstr))
+		state, diagnostics := simplifier.TypeCheckAll(tpl.Tree, type12{}, nil)
+		if test.message == "" && len(diagnostics) > 0 {
+			t.Errorf("Test(%v): unexpected diagnostics %v", i, diagnostics)
+		} else if test.message != "" && len(diagnostics) != 1 {
+			t.Errorf("Test(%v): expected a diagnostic, got %v", i, diagnostics)
+		} else if test.message != "" && diagnostics[0].Message != test.message {
+			t.Errorf("Test(%v): unexpected message\nexpected=%v\ngot     =%v", i, test.message, diagnostics[0].Message)
+		}
+		state.Enter()
+		if got := state.GetVar("$x"); got != test.expect {
+			t.Errorf("Test(%v): unexpected type of $x, expected=%v, got=%v", i, test.expect, got)
+		}
+	}
+}
+
+type type13 struct {
+	Name string
+	Any  interface{}
+	*type14
+}
+
+func (u *type13) FullName() string      { return u.Name }
+func (u *type13) Greet(s string) string { return s + u.Name }
+func (r *type14) Title() string         { return r.Role }
+func (d type15) Copy() type13           { return type13{} }
+func (d type15) Pair() (type13, error)  { return type13{}, nil }
+
+type type14 struct {
+	Role string
+}
+
+type type15 struct {
+	User  *type13
+	Users map[string]type13
+}
+
+func TestTypeCheckPointerMethods(t *testing.T) {
+	tests := []struct {
+		tplstr  string
+		data    interface{}
+		expect  reflect.Type
+		message string
+	}{
+		{`{{$x := .User.FullName}}`, type15{}, reflect.TypeOf(""), ""},
+		{`{{$x := .User.Greet "a"}}`, type15{}, reflect.TypeOf(""), ""},
+		{`{{$x := .User.Title}}`, type15{}, reflect.TypeOf(""), ""},
+		{`{{$x := .User.Role}}`, type15{}, reflect.TypeOf(""), ""},
+		{`{{$v := .User}}{{$x := $v.FullName}}`, type15{}, reflect.TypeOf(""), ""},
+		{`{{$x := .Users.a.Title}}`, type15{}, reflect.TypeOf(""), ""},
+		{`{{$x := .Copy.Title}}`, type15{}, reflect.TypeOf(""), ""},
+		{`{{$x := .Users.a.FullName}}`, type15{}, nil, "path [Users a FullName] not found in type simplifier_test.type13"},
+		{`{{$x := .Users.a.Greet "a"}}`, type15{}, nil, "path [Users a Greet] not found in type simplifier_test.type13"},
+		{`{{$x := .Copy.FullName}}`, type15{}, nil, "path [Copy FullName] not found in type simplifier_test.type13"},
+		{`{{$x := .Pair.FullName}}`, type15{}, nil, "path [Pair FullName] not found in type simplifier_test.type13"},
+		// the data given to a template is not addressable, the fields of a pointer are.
+		{`{{$x := .FullName}}`, &type13{}, reflect.TypeOf(""), ""},
+		{`{{$x := .FullName}}`, type13{}, nil, "path [FullName] not found in type simplifier_test.type13"},
+		{`{{$v := .}}{{$x := $v.FullName}}`, type13{}, nil, "path [FullName] not found in type simplifier_test.type13"},
+		{`{{with $v := .}}{{$x := .FullName}}{{end}}`, type13{}, nil, "path [FullName] not found in type simplifier_test.type13"},
+		// the elements of a slice are addressable, the ones of an array value or of a map are not.
+		{`{{range .}}{{$x := .FullName}}{{end}}`, []type13{}, reflect.TypeOf(""), ""},
+		{`{{range $i, $v := .}}{{$x := $v.FullName}}{{end}}`, []type13{}, reflect.TypeOf(""), ""},
+		{`{{range .}}{{$x := .FullName}}{{end}}`, &[1]type13{}, reflect.TypeOf(""), ""},
+		{`{{range .}}{{$x := .FullName}}{{end}}`, [1]type13{}, nil, "path [FullName] not found in type simplifier_test.type13"},
+		{`{{range .}}{{$x := .FullName}}{{end}}`, map[string]type13{}, nil, "path [FullName] not found in type simplifier_test.type13"},
+	}
+	for i, test := range tests {
+		tpl := template.Must(template.New("").Parse(test.tplstr))
+		state, diagnostics := simplifier.TypeCheckAll(tpl.Tree, test.data, nil)
+		if test.message == "" && len(diagnostics) > 0 {
+			t.Errorf("Test(%v): unexpected diagnostics %v", i, diagnostics)
+		} else if test.message != "" && len(diagnostics) != 1 {
+			t.Errorf("Test(%v): expected a diagnostic, got %v", i, diagnostics)
+		} else if test.message != "" && diagnostics[0].Message != test.message {
+			t.Errorf("Test(%v): unexpected message\nexpected=%v\ngot     =%v", i, test.message, diagnostics[0].Message)
+		}
+		// $x is declared in the last scope
+		for j := 0; j < state.Len(); j++ {
+			state.Enter()
+		}
+		if got := state.FindVar("$x"); got != test.expect {
+			t.Errorf("Test(%v): unexpected type of $x, expected=%v, got=%v", i, test.expect, got)
+		}
+	}
+
+	state := &simplifier.State{}
+	path := []string{"User", "FullName"}
+	if !state.IsMethodPath(path, reflect.TypeOf(type15{})) {
+		t.Errorf("expected %v to be a method path", path)
+	}
+	if got := state.ReflectPath(path, reflect.TypeOf(type15{})); got != reflect.TypeOf(func() string { return "" }) {
+		t.Errorf("unexpected type of %v, got %v", path, got)
+	}
+}
+
+type type16 struct {
+	Name   string
+	secret string
+	inner  type2
+	type17
+}
+
+type type17 struct {
+	Role string
+}
+
+func (t type16) hidden() string { return t.secret }
+
+func TestTypeCheckUnexported(t *testing.T) {
+	tests := []struct {
+		tplstr  string
+		message string
+	}{
+		{`{{.Name}}{{.Role}}`, ""},
+		{`{{.secret}}`, "secret is an unexported field of struct type simplifier_test.type16"},
+		{`{{.inner.Some}}`, "inner is an unexported field of struct type simplifier_test.type16"},
+		{`{{$v := .}}{{$v.secret}}`, "secret is an unexported field of struct type simplifier_test.type16"},
+		{`{{.secret "a"}}`, "secret is an unexported field of struct type simplifier_test.type16"},
+		{`{{.hidden}}`, "path [hidden] not found in type simplifier_test.type16"},
+	}
+	for i, test := range tests {
+		tpl := template.Must(template.New("").Parse(test.tplstr))
+		_, diagnostics := simplifier.TypeCheckAll(tpl.Tree, type16{}, nil)
+		if test.message == "" {
+			if len(diagnostics) > 0 {
+				t.Errorf("Test(%v): unexpected diagnostics %v", i, diagnostics)
+			}
+			continue
+		}
+		if len(diagnostics) != 1 {
+			t.Errorf("Test(%v): expected a diagnostic, got %v", i, diagnostics)
+			continue
+		}
+		if diagnostics[0].Message != test.message {
+			t.Errorf("Test(%v): unexpected message\nexpected=%v\ngot     =%v", i, test.message, diagnostics[0].Message)
+		}
+		if _, err := exectemplate(tpl, type16{}); err == nil {
+			t.Errorf("Test(%v): expected the template to fail at runtime", i)
+		}
+	}
+}
+
+func TestTypeCheckNumbers(t *testing.T) {
+	funcs := template.FuncMap{
+		"half":  func(f float64) float64 { return f / 2 },
+		"small": func(b uint8) uint8 { return b },
+		"big":   func(u uint64) uint64 { return u },
+	}
+	tpl := template.Must(template.New("").Funcs(funcs).Parse(
+		`{{$i := 1}}{{$f := 1.5}}{{$e := 1e3}}{{$c := 1i}}{{$r := 'a'}}{{$h := 0x1F}}{{$hf := 0x1p-2}}`))
+	state := simplifier.TypeCheck(tpl.Tree, type2{}, funcs)
+	state.Enter()
+	expectVars := map[string]reflect.Type{
+		"$i":  reflect.TypeOf(0),
+		"$f":  reflect.TypeOf(0.0),
+		"$e":  reflect.TypeOf(0.0),
+		"$c":  reflect.TypeOf(complex128(0)),
+		"$r":  reflect.TypeOf(0),
+		"$h":  reflect.TypeOf(0),
+		"$hf": reflect.TypeOf(0.0),
+	}
+	for name, expect := range expectVars {
+		if got := state.GetVar(name); got != expect {
+			t.Errorf("unexpected type of %v, expected=%v, got=%v", name, expect, got)
+		}
+	}
+
+	// the number arguments are converted to the type of the parameter.
+	tpl = template.Must(template.New("").Funcs(funcs).Parse(`{{half 1}}{{small 'a'}}{{print 1.5}}{{big 18446744073709551615}}`))
+	state = simplifier.TypeCheck(tpl.Tree, type2{}, funcs)
+	arg := func(i int) parse.Node {
+		return tpl.Tree.Root.Nodes[i].(*parse.ActionNode).Pipe.Cmds[0].Args[1]
+	}
+	expectArgs := []reflect.Type{
+		reflect.TypeOf(0.0),
+		reflect.TypeOf(uint8(0)),
+		reflect.TypeOf(0.0),
+		reflect.TypeOf(uint64(0)),
+	}
+	for i, expect := range expectArgs {
+		if got := state.TypeOf(arg(i)); got != expect {
+			t.Errorf("Test(%v): unexpected type of %v, expected=%v, got=%v", i, arg(i), expect, got)
+		}
+	}
+
+	tests := []struct {
+		tplstr  string
+		message string
+	}{
+		{`{{lt .Some 1.5}}`, "error calling lt: incompatible types for comparison"},
+		{`{{$x := 18446744073709551615}}`, "18446744073709551615 overflows int"},
+		{`{{print 18446744073709551615}}`, "18446744073709551615 overflows int"},
+		{`{{half 1i}}`, "wrong type for arg 1 of half: expected float64, got complex128"},
+		{`{{small 1.5}}`, "wrong type for arg 1 of small: expected uint8, got float64"},
+		{`{{1.5 | half}}`, ""},
+		{`{{1 | half}}`, "wrong type for arg 1 of half: expected float64, got int"},
+	}
+	for i, test := range tests {
+		tpl := template.Must(template.New("").Funcs(funcs).Parse(test.tplstr))
+		_, diagnostics := simplifier.TypeCheckAll(tpl.Tree, type2{}, funcs)
+		if test.message == "" {
+			if len(diagnostics) > 0 {
+				t.Errorf("Test(%v): unexpected diagnostics %v", i, diagnostics)
+			}
+			continue
+		}
+		if len(diagnostics) != 1 {
+			t.Errorf("Test(%v): expected a diagnostic, got %v", i, diagnostics)
+			continue
+		}
+		if diagnostics[0].Message != test.message {
+			t.Errorf("Test(%v): unexpected message\nexpected=%v\ngot     =%v", i, test.message, diagnostics[0].Message)
 		}
 	}
-	return ret, typeCheck
 }
@@ -29,12 +29,25 @@ func Unhole(tree *parse.Tree, state *State, funcs map[string]interface{}) {
 	state.Leave()
 }
 
+// UnholeE is like Unhole,
+// but it returns an error rather than panicking.
+func UnholeE(tree *parse.Tree, state *State, funcs map[string]interface{}) (err error) {
+	defer recoverError(&err)
+	Unhole(tree, state, funcs)
+	return nil
+}
+
 // treeTypecheck ...
 type treeUnhole struct {
 	tree  *parse.Tree
 	funcs map[string]interface{}
 }
 
+// error reports err located at node, it stops the processing.
+func (t *treeUnhole) error(node parse.Node, err error) {
+	panic(newDiagnostic(t.tree, node, SeverityError, err))
+}
+
 // browseNodes recursively.
 func (t *treeUnhole) browseNodes(l interface{}, state *State) {
 	switch node := l.(type) {
@@ -51,23 +64,13 @@ func (t *treeUnhole) browseNodes(l interface{}, state *State) {
 		t.browseNodes(node.Pipe, state)
 
 	case *parse.RangeNode:
-		state.Enter()
-		t.browseNodes(node.Pipe, state)
-		t.browseNodes(node.List, state)
-		t.browseNodes(node.ElseList, state)
-		state.Leave()
+		t.browseBranch(&node.BranchNode, state)
 
 	case *parse.IfNode:
-		t.browseNodes(node.Pipe, state)
-		t.browseNodes(node.List, state)
-		t.browseNodes(node.ElseList, state)
+		t.browseBranch(&node.BranchNode, state)
 
 	case *parse.WithNode:
-		state.Enter()
-		t.browseNodes(node.Pipe, state)
-		t.browseNodes(node.List, state)
-		t.browseNodes(node.ElseList, state)
-		state.Leave()
+		t.browseBranch(&node.BranchNode, state)
 
 	case *parse.TemplateNode:
 		if node.Pipe != nil {
@@ -87,6 +90,9 @@ func (t *treeUnhole) browseNodes(l interface{}, state *State) {
 			t.browseNodes(c, state)
 		}
 
+	case *parse.ChainNode:
+		t.browseNodes(node.Node, state)
+
 	case *parse.VariableNode:
 		//pass
 	case *parse.IdentifierNode:
@@ -97,16 +103,39 @@ func (t *treeUnhole) browseNodes(l interface{}, state *State) {
 		//pass
 	case *parse.BoolNode:
 		//pass
+	case *parse.NilNode:
+		//pass
+	case *parse.BreakNode:
+		//pass
+	case *parse.ContinueNode:
+		//pass
 	case *parse.DotNode:
 		//pass
 	case *parse.FieldNode:
 		//pass
 	case *parse.TextNode:
 		//pass
+	case *parse.CommentNode:
+		//pass
 
 	default:
-		err := fmt.Errorf("treeUnhole.browseNodes: unhandled node type\n%v\n%#v", node, node)
-		panic(err)
+		n, _ := node.(parse.Node)
+		err := &UnhandledNodeError{Op: "treeUnhole.browseNodes", Node: n}
+		t.error(n, err)
+	}
+}
+
+// browseBranch browses an if, a range or a with,
+// it enters the scopes of the body and of the else branch as the type check opened them.
+func (t *treeUnhole) browseBranch(node *parse.BranchNode, state *State) {
+	state.Enter()
+	t.browseNodes(node.Pipe, state)
+	t.browseNodes(node.List, state)
+	state.Leave()
+	if node.ElseList != nil {
+		state.Enter()
+		t.browseNodes(node.ElseList, state)
+		state.Leave()
 	}
 }
 
@@ -123,45 +152,41 @@ func (t *treeUnhole) unholeActionNode(node *parse.ActionNode, state *State) {
 		        {{$some := browse .b "c"}}
 		        or
 		        {{$some := browse $x.b "c"}}
+		        the same goes for chains
+		        {{$some := (index .a 0).b.c}}
 	*/
 	if len(node.Pipe.Decl) == 1 && len(node.Pipe.Cmds) == 1 {
 		decl := node.Pipe.Decl[0]
+		declType := state.GetVar(decl.Ident[0])
+		if node.Pipe.IsAssign {
+			// {{$some = .b.c}} assigns a variable declared in an enclosing scope.
+			declType = state.FindVar(decl.Ident[0])
+		}
 		// variable node
 		if variable, ok := node.Pipe.Cmds[0].Args[0].(*parse.VariableNode); ok && len(variable.Ident) > 1 {
-			if state.GetVar(decl.Ident[0]) == reflectInterface {
-				typedPath, unTypedPath := splitTypedPath(variable.Ident, state.GetVar(variable.Ident[0]))
+			if declType == reflectInterface {
+				// the path of the variable starts after its name.
+				typedPath, unTypedPath, err := splitTypedPath(variable.Ident[0], variable.Ident[1:], state.FindVar(variable.Ident[0]), state.isAddressable(variable.Ident[0]))
+				if err != nil {
+					t.error(variable, err)
+				}
+				typedPath = append([]string{variable.Ident[0]}, typedPath...)
 				if len(unTypedPath) > 0 {
 					args := []parse.Node{}
-					i := &parse.IdentifierNode{
-						NodeType: parse.NodeIdentifier,
-						Ident:    "browsePropertyPath",
-					}
+					// new nodes are positioned at the variable they replace.
+					i := parse.NewIdentifier("browsePropertyPath").SetTree(t.tree).SetPos(variable.Pos)
 					args = append(args, i)
-					if len(typedPath) == 0 {
-						v := &parse.VariableNode{
-							NodeType: parse.NodeVariable,
-							Ident:    variable.Ident[:1],
-						}
-						args = append(args, v)
-						t := &parse.StringNode{
-							NodeType: parse.NodeString,
-							Text:     strings.Join(unTypedPath[1:], "."),
-							Quoted:   "\"" + strings.Join(unTypedPath[1:], ".") + "\"",
-						}
-						args = append(args, t)
-					} else {
-						v := &parse.VariableNode{
-							NodeType: parse.NodeVariable,
-							Ident:    typedPath,
-						}
-						args = append(args, v)
-						t := &parse.StringNode{
-							NodeType: parse.NodeString,
-							Text:     strings.Join(unTypedPath, "."),
-							Quoted:   "\"" + strings.Join(unTypedPath, ".") + "\"",
-						}
-						args = append(args, t)
+					v := &parse.VariableNode{}
+					*v = *variable
+					v.Ident = typedPath
+					args = append(args, v)
+					t := &parse.StringNode{
+						NodeType: parse.NodeString,
+						Pos:      variable.Pos,
+						Text:     strings.Join(unTypedPath, "."),
+						Quoted:   "\"" + strings.Join(unTypedPath, ".") + "\"",
 					}
+					args = append(args, t)
 					identArgs := node.Pipe.Cmds[0].Args[1:]
 					args = append(args, identArgs...)
 					node.Pipe.Cmds[0].Args = append(node.Pipe.Cmds[0].Args[:0], args...)
@@ -169,29 +194,64 @@ func (t *treeUnhole) unholeActionNode(node *parse.ActionNode, state *State) {
 			}
 			// field node
 		} else if field, ok := node.Pipe.Cmds[0].Args[0].(*parse.FieldNode); ok && len(field.Ident) > 1 {
-			if state.GetVar(decl.Ident[0]) == reflectInterface {
-				typedPath, unTypedPath := splitTypedPath(field.Ident, state.Dot())
+			if declType == reflectInterface {
+				typedPath, unTypedPath, err := splitTypedPath(".", field.Ident, state.Dot(), state.isAddressable("."))
+				if err != nil {
+					t.error(field, err)
+				}
 				if len(unTypedPath) > 0 {
 					args := []parse.Node{}
-					i := &parse.IdentifierNode{
-						NodeType: parse.NodeIdentifier,
-						Ident:    "browsePropertyPath",
-					}
+					// new nodes are positioned at the field they replace.
+					i := parse.NewIdentifier("browsePropertyPath").SetTree(t.tree).SetPos(field.Pos)
 					args = append(args, i)
 					if len(typedPath) > 0 {
-						v := &parse.FieldNode{
-							NodeType: parse.NodeField,
-							Ident:    typedPath,
-						}
+						v := &parse.FieldNode{}
+						*v = *field
+						v.Ident = typedPath
 						args = append(args, v)
 					} else {
 						v := &parse.DotNode{
 							NodeType: parse.NodeDot,
+							Pos:      field.Pos,
 						}
 						args = append(args, v)
 					}
 					t := &parse.StringNode{
 						NodeType: parse.NodeString,
+						Pos:      field.Pos,
+						Text:     strings.Join(unTypedPath, "."),
+						Quoted:   "\"" + strings.Join(unTypedPath, ".") + "\"",
+					}
+					args = append(args, t)
+					identArgs := node.Pipe.Cmds[0].Args[1:]
+					args = append(args, identArgs...)
+					node.Pipe.Cmds[0].Args = append(node.Pipe.Cmds[0].Args[:0], args...)
+				}
+			}
+			// chain node
+		} else if chain, ok := node.Pipe.Cmds[0].Args[0].(*parse.ChainNode); ok {
+			if declType == reflectInterface {
+				typer := &treeTypecheck{tree: t.tree, funcs: t.funcs}
+				typedPath, unTypedPath, err := splitTypedPath(chain.Node.String(), chain.Field, typer.argType(chain.Node, state), false)
+				if err != nil {
+					t.error(chain, err)
+				}
+				if len(unTypedPath) > 0 {
+					args := []parse.Node{}
+					// new nodes are positioned at the chain they replace.
+					i := parse.NewIdentifier("browsePropertyPath").SetTree(t.tree).SetPos(chain.Pos)
+					args = append(args, i)
+					if len(typedPath) > 0 {
+						v := &parse.ChainNode{}
+						*v = *chain
+						v.Field = typedPath
+						args = append(args, v)
+					} else {
+						args = append(args, chain.Node)
+					}
+					t := &parse.StringNode{
+						NodeType: parse.NodeString,
+						Pos:      chain.Pos,
 						Text:     strings.Join(unTypedPath, "."),
 						Quoted:   "\"" + strings.Join(unTypedPath, ".") + "\"",
 					}
@@ -203,41 +263,50 @@ func (t *treeUnhole) unholeActionNode(node *parse.ActionNode, state *State) {
 			}
 		}
 	} else if len(node.Pipe.Decl) == 1 && len(node.Pipe.Cmds) > 1 {
-		err := fmt.Errorf("treeUnhole.unholeActionNode: unhandled length of node.Pipe.Decl or node.Pipe.Cmds\n%v\n%#v", node, node)
-		panic(err)
+		err := &UnhandledNodeError{Op: "treeUnhole.unholeActionNode", Node: node, Reason: "unhandled length of node.Pipe.Decl or node.Pipe.Cmds"}
+		t.error(node, err)
 	}
 }
 
-func splitTypedPath(path []string, val reflect.Type) ([]string, []string) {
+// splitTypedPath splits path into its statically typed part
+// and the part which can only be resolved at runtime.
+// The path starts from name, the variable, the dot or the chain, holding a value of type val,
+// a nil type means that name was not found, addressable tells if the value is addressable.
+func splitTypedPath(name string, path []string, val reflect.Type, addressable bool) ([]string, []string, error) {
+	if val == nil {
+		return nil, nil, &VariableNotFoundError{Op: "splitTypedPath", Name: name}
+	}
 	for i, p := range path {
 		if val.Kind() == reflect.Interface {
-			return path[:i], path[i:]
+			return path[:i], path[i:], nil
+		}
+		val, addressable = indirectType(val, addressable)
+		field, meth, fieldAddressable, err := pathElem("splitTypedPath", val, p, addressable)
+		if err != nil {
+			return nil, nil, err
 		}
-		field, found := val.FieldByName(p)
-		if found {
-			if field.Type.Kind() == reflect.Struct {
-				val = field.Type
-			} else {
-				return path[:i], path[i:]
+		if meth != nil {
+			if !isGoodFunc(meth) {
+				err := fmt.Errorf("splitTypedPath: Found method %v of type %v, it must return one value, or one value and an error, impossible processing of %v in %v", p, meth, path, val)
+				return nil, nil, err
 			}
-		} else {
-			meth, found := val.MethodByName(p)
-			if found {
-				if meth.Type.NumOut() == 0 {
-					err := fmt.Errorf("splitTypedPath: Found void method, impossible processing of %v in %v", path, val)
-					panic(err)
-				}
-				if meth.Type.Out(0).Kind() == reflect.Struct {
-					val = field.Type
-				} else {
-					err := fmt.Errorf("splitTypedPath: Found non struct method return parameter, impossible processing of %v in %v", path, val)
-					panic(err)
-				}
-			} else {
-				err := fmt.Errorf("splitTypedPath: Path not found %v in %v", path, val)
-				panic(err)
+			if next, _ := indirectType(meth.Out(0), false); next.Kind() == reflect.Struct {
+				val, addressable = meth.Out(0), false
+				continue
 			}
+			err := fmt.Errorf("splitTypedPath: Found non struct method return parameter, impossible processing of %v in %v", path, val)
+			return nil, nil, err
+		}
+		if field == nil {
+			err := &PathNotFoundError{Op: "splitTypedPath", Path: path, Type: val}
+			return nil, nil, err
+		}
+		// a field, or a map key, is typed when it holds a struct or a map.
+		if next, _ := indirectType(field, false); next.Kind() == reflect.Struct || next.Kind() == reflect.Map {
+			val, addressable = field, fieldAddressable
+		} else {
+			return path[:i], path[i:], nil
 		}
 	}
-	return path, []string{}
+	return path, []string{}, nil
 }
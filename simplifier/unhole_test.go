@@ -5,11 +5,20 @@ import (
 	"strings"
 	"testing"
 	"text/template"
+	"text/template/parse"
 
 	"github.com/mh-cbon/template-tree-simplifier/funcmap"
 	"github.com/mh-cbon/template-tree-simplifier/simplifier"
 )
 
+type type10 struct{}
+
+func (t type10) Item() (type4, error) { return type4{Some: type2{Some: "x"}}, nil }
+
+type type18 struct {
+	In type12
+}
+
 func TestUnhole(t *testing.T) {
 	//-
 	defFuncs := template.FuncMap{
@@ -127,6 +136,76 @@ func TestUnhole(t *testing.T) {
 				},
 			},
 		},
+		TestData{
+			tplstr:       `{{$x := .Item.Some.Some}}`,
+			expectTplStr: `{{$tplX := browsePropertyPath .Item "Some.Some"}}`,
+			funcs:        defFuncs,
+			unhole:       true,
+			data:         type10{},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type10{}),
+					"$tplX": reflectInterface,
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{$x := .Any.db.host}}{{$x}}`,
+			expectTplStr: `{{$tplX := browsePropertyPath .Any "db.host"}}{{$tplX}}`,
+			funcs:        defFuncs,
+			unhole:       true,
+			data:         type12{Any: map[string]interface{}{"db": map[string]string{"host": "h"}}},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type12{}),
+					"$tplX": reflectInterface,
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{$v := .In}}{{$y := $v.Any.k}}{{$y}}`,
+			expectTplStr: `{{$tplV := .In}}{{$tplY := browsePropertyPath $tplV.Any "k"}}{{$tplY}}`,
+			funcs:        defFuncs,
+			unhole:       true,
+			data:         type18{In: type12{Any: map[string]interface{}{"k": "v"}}},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type18{}),
+					"$tplV": reflect.TypeOf(type12{}),
+					"$tplY": reflectInterface,
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{$v := .In}}{{if true}}{{$y := $v.Any.k}}{{$y}}{{end}}`,
+			expectTplStr: `{{$tplV := .In}}{{if true}}{{$tplY := browsePropertyPath $tplV.Any "k"}}{{$tplY}}{{end}}`,
+			funcs:        defFuncs,
+			unhole:       true,
+			data:         type18{In: type12{Any: map[string]interface{}{"k": "v"}}},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type18{}),
+					"$tplV": reflect.TypeOf(type12{}),
+				},
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type18{}),
+					"$tplY": reflectInterface,
+				},
+			},
+		},
+		TestData{
+			tplstr:       `{{$x := .User.Any.Some}}{{$x}}`,
+			expectTplStr: `{{$tplX := browsePropertyPath .User "Any.Some"}}{{$tplX}}`,
+			funcs:        defFuncs,
+			unhole:       true,
+			data:         type15{User: &type13{Any: type2{Some: "s"}}},
+			checkedTypes: []map[string]reflect.Type{
+				map[string]reflect.Type{
+					".":     reflect.TypeOf(type15{}),
+					"$tplX": reflectInterface,
+				},
+			},
+		},
 		TestData{
 			tplstr:       `{{$x := intf}}`,
 			expectTplStr: `{{$tplX := intf}}`,
@@ -167,6 +246,9 @@ func TestUnhole(t *testing.T) {
 					".":     reflect.TypeOf(type4{}),
 					"$var0": reflectInterface,
 				},
+				map[string]reflect.Type{
+					".": reflect.TypeOf(type4{}),
+				},
 			},
 		},
 		TestData{
@@ -253,13 +335,31 @@ func unholetemplate(t *template.Template, testData TestData) (*template.Template
 	if err != nil {
 		panic(err)
 	}
-	var typeCheck *simplifier.State
+	trees := map[string]*parse.Tree{}
 	for _, t := range ret.Templates() {
 		if t.Tree != nil {
 			simplifier.Simplify(t.Tree)
-			typeCheck = simplifier.TypeCheck(t.Tree, testData.data, testData.funcs)
-			simplifier.Unhole(t.Tree, typeCheck, testData.funcs)
+			trees[t.Name()] = t.Tree
 		}
 	}
-	return ret, typeCheck
+	states, _ := simplifier.TypeCheckTemplates(trees, ret.Name(), testData.data, testData.funcs)
+	for name, tree := range trees {
+		simplifier.Unhole(tree, states[name][0], testData.funcs)
+	}
+	return ret, states[ret.Name()][0]
+}
+
+func TestUnholeChain(t *testing.T) {
+	funcs := template.FuncMap{
+		"mk":                 func() type4 { return type4{Some: type2{Some: "x"}} },
+		"browsePropertyPath": funcmap.BrowsePropertyPath,
+	}
+	tpl := template.Must(template.New("").Funcs(funcs).Parse(`{{$x := (mk).Some.Some}}{{$x}}`))
+	// the tree is not simplified, the chain is unholed as is.
+	state := simplifier.TypeCheck(tpl.Tree, nil, funcs)
+	simplifier.Unhole(tpl.Tree, state, funcs)
+	expected := `{{$x := browsePropertyPath (mk) "Some.Some"}}{{$x}}`
+	if got := tpl.Tree.Root.String(); got != expected {
+		t.Errorf("unexpected unholed template, expected=%v, got=%v", expected, got)
+	}
 }
@@ -1,7 +1,6 @@
 package simplifier
 
 import (
-	"fmt"
 	"strconv"
 	// "github.com/mh-cbon/print-template-tree/printer"
 	"text/template/parse"
@@ -17,6 +16,14 @@ func Unshadow(tree *parse.Tree) {
 	t.browseToUnshadow(tree.Root)
 }
 
+// UnshadowE is like Unshadow,
+// but it returns an error rather than panicking.
+func UnshadowE(tree *parse.Tree) (err error) {
+	defer recoverError(&err)
+	Unshadow(tree)
+	return nil
+}
+
 // treeUnshadower holds
 // a list of declared variable within the template
 // a map of variable rename (original=>new name)
@@ -63,6 +70,24 @@ func (t *treeUnshadower) rename(varname string) string {
 	return varname
 }
 
+// enterScope starts a new scope of renames,
+// it returns the renames of the enclosing scope to restore them with leaveScope.
+// A variable is visible until the end of the control structure in which it is declared,
+// so are the renames of its declaration.
+func (t *treeUnshadower) enterScope() map[string]string {
+	renames := t.currentRenames
+	t.currentRenames = map[string]string{}
+	for k, v := range renames {
+		t.currentRenames[k] = v
+	}
+	return renames
+}
+
+// leaveScope restores the renames of the enclosing scope.
+func (t *treeUnshadower) leaveScope(renames map[string]string) {
+	t.currentRenames = renames
+}
+
 // getName returns the variable rename, or the variable name.
 func (t *treeUnshadower) getName(n string) string {
 	if t, ok := t.currentRenames[n]; ok {
@@ -71,6 +96,11 @@ func (t *treeUnshadower) getName(n string) string {
 	return n
 }
 
+// error reports err located at node, it stops the processing.
+func (t *treeUnshadower) error(node parse.Node, err error) {
+	panic(newDiagnostic(t.tree, node, SeverityError, err))
+}
+
 // browseToUnshadow browses all nodes and unshadow variable
 func (t *treeUnshadower) browseToUnshadow(l interface{}) {
 	switch node := l.(type) {
@@ -91,7 +121,13 @@ func (t *treeUnshadower) browseToUnshadow(l interface{}) {
 			t.browseToUnshadow(child)
 		}
 		for _, child := range node.Decl {
-			t.handleDecl(child)
+			if node.IsAssign {
+				// {{$v = ""}} assigns the variable in scope,
+				// it is renamed like any other use.
+				t.browseToUnshadow(child)
+			} else {
+				t.handleDecl(child)
+			}
 		}
 
 	case *parse.CommandNode:
@@ -99,20 +135,35 @@ func (t *treeUnshadower) browseToUnshadow(l interface{}) {
 			t.browseToUnshadow(child)
 		}
 
+	case *parse.ChainNode:
+		t.browseToUnshadow(node.Node)
+
 	case *parse.RangeNode:
+		renames := t.enterScope()
 		t.browseToUnshadow(node.Pipe)
+		listRenames := t.enterScope()
 		t.browseToUnshadow(node.List)
+		t.leaveScope(listRenames)
 		t.browseToUnshadow(node.ElseList)
+		t.leaveScope(renames)
 
 	case *parse.IfNode:
+		renames := t.enterScope()
 		t.browseToUnshadow(node.Pipe)
+		listRenames := t.enterScope()
 		t.browseToUnshadow(node.List)
+		t.leaveScope(listRenames)
 		t.browseToUnshadow(node.ElseList)
+		t.leaveScope(renames)
 
 	case *parse.WithNode:
+		renames := t.enterScope()
 		t.browseToUnshadow(node.Pipe)
+		listRenames := t.enterScope()
 		t.browseToUnshadow(node.List)
+		t.leaveScope(listRenames)
 		t.browseToUnshadow(node.ElseList)
+		t.leaveScope(renames)
 
 	case *parse.TemplateNode:
 		if node.Pipe != nil {
@@ -127,8 +178,16 @@ func (t *treeUnshadower) browseToUnshadow(l interface{}) {
 		// pass
 	case *parse.BoolNode:
 		// pass
+	case *parse.NilNode:
+		// pass
+	case *parse.BreakNode:
+		// pass
+	case *parse.ContinueNode:
+		// pass
 	case *parse.TextNode:
 		// pass
+	case *parse.CommentNode:
+		// pass
 	case *parse.DotNode:
 		// pass
 	case *parse.FieldNode:
@@ -138,8 +197,9 @@ func (t *treeUnshadower) browseToUnshadow(l interface{}) {
 		node.Ident[0] = t.getName(node.Ident[0])
 
 	default:
-		err := fmt.Errorf("treeUnshadower.browseToUnshadow: unhandled node type\n%v\n%#v", node, node)
-		panic(err)
+		n, _ := node.(parse.Node)
+		err := &UnhandledNodeError{Op: "treeUnshadower.browseToUnshadow", Node: n}
+		t.error(n, err)
 	}
 }
 
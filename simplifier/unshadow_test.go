@@ -70,6 +70,26 @@ func TestUnshadow(t *testing.T) {
 			funcs:        defFuncs,
 			unshadow:     true,
 		},
+		TestData{
+			tplstr:       `{{$x := eq . nil}}{{if $x}}{{$x := eq . nil}}{{end}}`,
+			expectTplStr: `{{$x := eq . nil}}{{if $x}}{{$xShadow := eq . nil}}{{end}}`,
+			funcs:        defFuncs,
+			unshadow:     true,
+		},
+		TestData{
+			tplstr:       `{{$x := 1}}{{range .}}{{$x := 2}}{{$x = 3}}{{$x}}{{end}}{{$x = 4}}{{$x}}`,
+			expectTplStr: `{{$x := 1}}{{range .}}{{$xShadow := 2}}{{$xShadow = 3}}{{$xShadow}}{{end}}{{$x = 4}}{{$x}}`,
+			funcs:        defFuncs,
+			data:         []string{"a"},
+			unshadow:     true,
+		},
+		TestData{
+			tplstr:       `{{$x := 1}}{{range .}}{{$x := 2}}{{if true}}{{break}}{{end}}{{end}}`,
+			expectTplStr: `{{$x := 1}}{{range .}}{{$xShadow := 2}}{{if true}}{{break}}{{end}}{{end}}`,
+			funcs:        defFuncs,
+			data:         []string{"a"},
+			unshadow:     true,
+		},
 	}
 
 	for i, testData := range testTable {
@@ -1,7 +1,6 @@
 package simplifier
 
 import (
-	"fmt"
 	"text/template/parse"
 )
 
@@ -48,6 +47,11 @@ func browseNodesToCheckIfDotIsUsed(l interface{}) bool {
 			}
 		}
 
+	case *parse.ChainNode:
+		if browseNodesToCheckIfDotIsUsed(node.Node) {
+			return true
+		}
+
 	case *parse.RangeNode:
 		if browseNodesToCheckIfDotIsUsed(node.Pipe) {
 			return true
@@ -103,6 +107,12 @@ func browseNodesToCheckIfDotIsUsed(l interface{}) bool {
 		// pass
 	case *parse.BoolNode:
 		// pass
+	case *parse.NilNode:
+		// pass
+	case *parse.BreakNode:
+		// pass
+	case *parse.ContinueNode:
+		// pass
 	case *parse.IdentifierNode:
 		// pass
 	case *parse.DotNode:
@@ -111,9 +121,12 @@ func browseNodesToCheckIfDotIsUsed(l interface{}) bool {
 		return true // easy one
 	case *parse.TextNode:
 		// pass
+	case *parse.CommentNode:
+		// pass
 
 	default:
-		err := fmt.Errorf("browseNodesToCheckIfDotIsUsed: unhandled node type\n%v\n%#v", node, node)
+		n, _ := node.(parse.Node)
+		err := &UnhandledNodeError{Op: "browseNodesToCheckIfDotIsUsed", Node: n}
 		panic(err)
 	}
 	return false
@@ -72,6 +72,13 @@ func TestUseDot(t *testing.T) {
 			usedot:       true,
 			expectDotUse: true,
 		},
+		TestData{
+			tplstr:       `{{if eq .Some nil}}{{end}}`,
+			funcs:        defFuncs,
+			data:         type5{},
+			usedot:       true,
+			expectDotUse: true,
+		},
 	}
 
 	for i, testData := range testTable {